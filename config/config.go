@@ -2,6 +2,8 @@ package config
 
 import (
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
@@ -14,22 +16,84 @@ const (
 
 	DefaultScrapeHistory  bool          = true
 	DefaultScrapeInterval time.Duration = time.Minute * 5
+	DefaultScrapeWorkers  int           = 4
+	DefaultStreamUserData bool          = false
 
-	DefaultExcWeightLimit    int32         = 500
-	DefaultExcWeightCooldown time.Duration = 60 * time.Second
+	DefaultExcWeightLimit int32 = 500
+
+	DefaultRetryAttempts   int           = 3
+	DefaultRetryBackoff    time.Duration = time.Second
+	DefaultRetryMaxBackoff time.Duration = 30 * time.Second
+
+	DefaultBreakerThreshold int           = 5
+	DefaultBreakerCooldown  time.Duration = time.Hour
+
+	DefaultPriceResolution time.Duration = time.Hour
+
+	DefaultReportingCurrency string = model.QuoteAsset
+
+	DefaultCandleHistory time.Duration = 30 * 24 * time.Hour
 )
 
+// DefaultCandleIntervals are the candle intervals scraped when none are
+// configured.
+var DefaultCandleIntervals = []string{"1h"}
+
 var (
 	APIPort int    = DefaultAPIPort
 	DBPath  string = DefaultDBPath
 
 	ScrapeHistory                = DefaultScrapeHistory
 	ScrapeInterval time.Duration = DefaultScrapeInterval
-
-	ExchangeWeightLimit    int32         = DefaultExcWeightLimit
-	ExchangeWeightCooldown time.Duration = DefaultExcWeightCooldown
+	ScrapeWorkers  int           = DefaultScrapeWorkers
+
+	// TaskIntervals are the intervals scrape tasks run at by task name,
+	// such as prices, positions or income. Tasks not listed run every
+	// ScrapeInterval, and portfolios can list intervals of their own.
+	TaskIntervals = map[string]time.Duration{}
+
+	// StreamUserData keeps positions, balances and orders of exchanges with
+	// a user data stream up to date between scrapes.
+	StreamUserData bool = DefaultStreamUserData
+
+	// ExchangeWeightLimits override the request weight used per minute and
+	// API key, by exchange. Exchanges not listed use the limit of their
+	// adapter, or DefaultExcWeightLimit if it has none.
+	ExchangeWeightLimits = map[string]int32{}
+
+	// RetryAttempts is how often a scrape task failing with a transient
+	// error is retried. Retries back off exponentially from RetryBackoff,
+	// up to RetryMaxBackoff.
+	RetryAttempts   int           = DefaultRetryAttempts
+	RetryBackoff    time.Duration = DefaultRetryBackoff
+	RetryMaxBackoff time.Duration = DefaultRetryMaxBackoff
+
+	// BreakerThreshold is how many scrapes of a portfolio fail in a row
+	// before scraping it is paused for BreakerCooldown. 0 never pauses it.
+	BreakerThreshold int           = DefaultBreakerThreshold
+	BreakerCooldown  time.Duration = DefaultBreakerCooldown
+
+	// PriceResolution is how often prices are sampled into price history.
+	PriceResolution time.Duration = DefaultPriceResolution
+
+	// ReportingCurrency is the currency figures are normalized into when
+	// they are read, such as USD, EUR or BTC.
+	ReportingCurrency string = DefaultReportingCurrency
+
+	// CandleIntervals are the intervals candles of traded symbols are
+	// scraped at, out of model.CandleIntervals.
+	CandleIntervals = DefaultCandleIntervals
+	// CandleHistory is how far back candles of a symbol are first scraped.
+	CandleHistory time.Duration = DefaultCandleHistory
 )
 
+// deprecatedFields are config fields that are no longer read, and what to
+// do instead.
+var deprecatedFields = map[string]string{
+	"exchange_weight_limit":  "set exchange_weight_limits by exchange instead",
+	"exchange_cooldown_secs": "exchanges are backed off for as long as they ask",
+}
+
 func Load() error {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -39,16 +103,38 @@ func Load() error {
 		return fmt.Errorf("failed to read config: %v", err)
 	}
 
-	var cooldown int64
-	var interval int64
+	var interval, priceResolution, candleHistoryDays int64
+	var retryBackoff, retryMaxBackoff, breakerCooldown int64
+	var taskIntervals map[string]int64
 	fields := map[string]interface{}{
 		"api_port": &APIPort,
 
 		"scrape_history":       &ScrapeHistory,
 		"scrape_interval_secs": &interval,
+		"scrape_workers":       &ScrapeWorkers,
+		"task_intervals_secs":  &taskIntervals,
+		"stream_user_data":     &StreamUserData,
+
+		"exchange_weight_limits": &ExchangeWeightLimits,
 
-		"exchange_weight_limit":  &ExchangeWeightLimit,
-		"exchange_cooldown_secs": &cooldown,
+		"retry_attempts":         &RetryAttempts,
+		"retry_backoff_secs":     &retryBackoff,
+		"retry_max_backoff_secs": &retryMaxBackoff,
+
+		"breaker_threshold":     &BreakerThreshold,
+		"breaker_cooldown_secs": &breakerCooldown,
+
+		"price_resolution_secs": &priceResolution,
+		"reporting_currency":    &ReportingCurrency,
+
+		"candle_intervals":    &CandleIntervals,
+		"candle_history_days": &candleHistoryDays,
+	}
+
+	for field, hint := range deprecatedFields {
+		if viper.IsSet(field) {
+			log.Printf("config: %s is no longer read, %s", field, hint)
+		}
 	}
 
 	for field, ptr := range fields {
@@ -57,12 +143,60 @@ func Load() error {
 		}
 	}
 
-	ExchangeWeightCooldown = time.Duration(cooldown) * time.Second
-	ScrapeInterval = time.Duration(interval) * time.Second
+	if interval > 0 {
+		ScrapeInterval = time.Duration(interval) * time.Second
+	}
+
+	TaskIntervals = ParseTaskIntervals(taskIntervals)
+
+	if priceResolution > 0 {
+		PriceResolution = time.Duration(priceResolution) * time.Second
+	}
+
+	if retryBackoff > 0 {
+		RetryBackoff = time.Duration(retryBackoff) * time.Second
+	}
+
+	if retryMaxBackoff > 0 {
+		RetryMaxBackoff = time.Duration(retryMaxBackoff) * time.Second
+	}
+
+	if breakerCooldown > 0 {
+		BreakerCooldown = time.Duration(breakerCooldown) * time.Second
+	}
+
+	ReportingCurrency = strings.ToUpper(ReportingCurrency)
+	if ReportingCurrency == "" {
+		ReportingCurrency = DefaultReportingCurrency
+	}
+
+	for _, interval := range CandleIntervals {
+		if _, ok := model.CandleIntervals[interval]; !ok {
+			return fmt.Errorf("unsupported candle interval: %s", interval)
+		}
+	}
+
+	if candleHistoryDays > 0 {
+		CandleHistory = time.Duration(candleHistoryDays) * 24 * time.Hour
+	}
 
 	return nil
 }
 
+// ParseTaskIntervals converts intervals in seconds by task name into
+// durations. Names may be written with underscores in place of spaces,
+// such as balance_history, and intervals below a second are left out.
+func ParseTaskIntervals(secs map[string]int64) map[string]time.Duration {
+	intervals := make(map[string]time.Duration, len(secs))
+	for task, s := range secs {
+		if s > 0 {
+			intervals[strings.ReplaceAll(strings.ToLower(task), "_", " ")] = time.Duration(s) * time.Second
+		}
+	}
+
+	return intervals
+}
+
 func GetPortfolios() ([]*model.Portfolio, error) {
 	portfolios := []*model.Portfolio{}
 
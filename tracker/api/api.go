@@ -1,9 +1,11 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -12,17 +14,39 @@ import (
 	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
 )
 
-func Serve(repo repository.Repository) {
+// shutdownTimeout is how long requests in flight are given to finish once
+// the server is shut down.
+const shutdownTimeout = 10 * time.Second
+
+// Serve serves the api until ctx is done, then shuts the server down
+// gracefully.
+func Serve(ctx context.Context, repo repository.Repository) error {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 
 	r.Route("/api", func(r chi.Router) {
-		r.Mount("/chartjs", chartjs.Route())
+		r.Mount("/chartjs", chartjs.Route(repo))
 	})
 
 	port := fmt.Sprintf(":%d", config.APIPort)
-	log.Printf("listening on port %s", port)
-	http.ListenAndServe(port, r)
+	server := &http.Server{Addr: port, Handler: r}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("listening on port %s", port)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Println("shutting down api")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	_ = repo
+	return server.Shutdown(shutdownCtx)
 }
@@ -1,13 +1,33 @@
 package chartjs
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/valuation"
 )
 
-func Route() chi.Router {
+const defaultChartDays = 30
+
+type chart struct {
+	Labels   []string  `json:"labels"`
+	Datasets []dataset `json:"datasets"`
+}
+
+type dataset struct {
+	Label string    `json:"label"`
+	Data  []float64 `json:"data"`
+}
+
+func Route(repo repository.Reader) chi.Router {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
@@ -19,5 +39,72 @@ func Route() chi.Router {
 		w.Write([]byte("ChartJS API"))
 	})
 
+	r.Get("/income", func(w http.ResponseWriter, r *http.Request) {
+		income(w, r, repo)
+	})
+
 	return r
 }
+
+// income charts the daily income of every portfolio over the last days,
+// in the currency query parameter or the reporting currency.
+func income(w http.ResponseWriter, r *http.Request, repo repository.Reader) {
+	currency := strings.ToUpper(r.URL.Query().Get("currency"))
+	if currency == "" {
+		currency = config.ReportingCurrency
+	}
+
+	days := defaultChartDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			http.Error(w, fmt.Sprintf("invalid days: %s", value), http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	reader := valuation.NewReader(repo, currency)
+	portfolios, err := reader.GetPortfolios()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	end := time.Now().UTC()
+	start := end.Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+
+	result := chart{}
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		result.Labels = append(result.Labels, date.Format("2006-01-02"))
+	}
+
+	for _, portfolio := range portfolios {
+		incomes, err := reader.GetPortfolioIncomeBetween(portfolio, start.UnixMilli(), end.UnixMilli())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := make([]float64, len(result.Labels))
+		for _, income := range incomes {
+			// transfers are not income
+			if income.Type == "TRANSFER" {
+				continue
+			}
+
+			day := int(income.Date.UTC().Sub(start) / (24 * time.Hour))
+			if day >= 0 && day < len(data) {
+				data[day] += income.Value
+			}
+		}
+
+		result.Datasets = append(result.Datasets, dataset{
+			Label: fmt.Sprintf("%s (%s)", portfolio.Alias, currency),
+			Data:  data,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,191 @@
+// Package cli implements the dashboard commands. It is importable, so a
+// separate module can build its own dashboard binary with additional
+// exchange adapters registered.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/api"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository/sqlite3"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper/exchange"
+	"gorm.io/driver/sqlite"
+)
+
+const (
+	SCRAPE = iota
+	SERVE
+	EXCHANGES
+	BREAKERS
+)
+
+// Run runs the command given in args, scraping when there is none. The
+// command is stopped gracefully on SIGINT or SIGTERM.
+func Run(args []string) {
+	command := GetCommand(args)
+
+	// listing exchanges does not need a config
+	if command == EXCHANGES {
+		ListExchanges()
+		return
+	}
+
+	err := config.Load()
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to load config: %v", err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch command {
+	case SCRAPE:
+		StartScraper(ctx)
+	case SERVE:
+		StartAPI(ctx)
+	case BREAKERS:
+		ListBreakers()
+	default:
+		log.Fatal(fmt.Errorf("unknown command: %s", args[0]))
+	}
+}
+
+func GetCommand(args []string) (command int) {
+	if len(args) == 0 {
+		return SCRAPE
+	}
+
+	switch args[0] {
+	case "serve":
+		return SERVE
+	case "exchanges":
+		return EXCHANGES
+	case "breakers":
+		return BREAKERS
+	default:
+		return -1
+	}
+}
+
+func GetRepo() (repo repository.Repository, err error) {
+	dialector := sqlite.Open(config.DBPath)
+	repo, err = sqlite3.NewRepository(dialector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize repository: %v", err)
+	}
+
+	return repo, nil
+}
+
+// StartScraper scrapes continuously until ctx is done.
+func StartScraper(ctx context.Context) {
+	repo, err := GetRepo()
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to initialize repository: %v", err))
+	}
+
+	scraper, err := scraper.NewScraper(repo)
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to initialize scraper: %v", err))
+	}
+
+	err = scraper.ContinuousScrape(ctx)
+	if ctx.Err() != nil {
+		log.Println("scraper stopped")
+		return
+	}
+
+	if err != nil {
+		log.Fatal(fmt.Errorf("initial scrape failed: %v", err))
+	}
+}
+
+// StartAPI serves the api until ctx is done.
+func StartAPI(ctx context.Context) {
+	repo, err := GetRepo()
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to initialize repository: %v", err))
+	}
+
+	if err := api.Serve(ctx, repo); err != nil {
+		log.Fatal(fmt.Errorf("api failed: %v", err))
+	}
+}
+
+// ListExchanges prints the registered exchange adapters, what they scrape
+// and the config fields they read beside key and secret.
+func ListExchanges() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDESCRIPTION\tCAPABILITIES\tCONFIG FIELDS")
+
+	for _, def := range exchange.Definitions() {
+		capabilities := make([]string, 0, len(def.Capabilities))
+		for _, capability := range def.Capabilities {
+			capabilities = append(capabilities, string(capability))
+		}
+
+		fields := make([]string, 0, len(def.Fields))
+		for _, field := range def.Fields {
+			name := field.Name
+			if !field.Required {
+				name += " (optional)"
+			}
+			fields = append(fields, name)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			def.Name,
+			def.Description,
+			strings.Join(capabilities, ", "),
+			strings.Join(fields, ", "),
+		)
+	}
+
+	w.Flush()
+}
+
+// ListBreakers prints the circuit breaker of every portfolio scraped so
+// far, and why and until when open ones pause scraping.
+func ListBreakers() {
+	repo, err := GetRepo()
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to initialize repository: %v", err))
+	}
+
+	breakers, err := repo.GetPortfolioBreakers()
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to get circuit breakers: %v", err))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORTFOLIO\tSTATE\tFAILURES\tRETRY AT\tLAST ERROR")
+
+	for _, breaker := range breakers {
+		retryAt := ""
+		if breaker.State != model.BreakerClosed {
+			retryAt = breaker.RetryAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			breaker.PortfolioID,
+			breaker.State,
+			breaker.Failures,
+			retryAt,
+			breaker.LastError,
+		)
+	}
+
+	w.Flush()
+}
@@ -1,10 +1,18 @@
 package model
 
 import (
+	"context"
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// QuoteAsset is the currency balances and income are valued in.
+const QuoteAsset = "USDT"
+
 type PortfolioID string
 
 type Portfolio struct {
@@ -14,10 +22,41 @@ type Portfolio struct {
 	APIKey         string      `gorm:"-" mapstructure:"key"`
 	APISecret      string      `gorm:"-" mapstructure:"secret"`
 	HistoryScraped bool        `gorm:"type:bool;default:false" mapstructure:"-"`
+	IncomeCursor   int64       `gorm:"type:bigint;default:0" mapstructure:"-"`
+	TransferCursor int64       `gorm:"type:bigint;default:0" mapstructure:"-"`
+	// IncomeHistoryCursor is the time of the oldest income the history
+	// scrape has reached, so an interrupted one resumes from there.
+	IncomeHistoryCursor int64 `gorm:"type:bigint;default:0" mapstructure:"-"`
+	// BalancesDerived is set once daily balances before the first scrape
+	// are derived from income and transfer history.
+	BalancesDerived bool `gorm:"type:bool;default:false" mapstructure:"-"`
+
+	// TaskIntervals overrides the intervals in seconds scrape tasks of the
+	// portfolio run at, by task name.
+	TaskIntervals map[string]int64 `gorm:"-" mapstructure:"task_intervals_secs"`
+
+	// Options holds the remaining config fields of the portfolio, read by
+	// exchange adapters that need more than an API key and secret.
+	Options map[string]interface{} `gorm:"-" mapstructure:",remain"`
+}
+
+// Option returns the config field of the portfolio, or an empty string
+// if it is not set.
+func (p *Portfolio) Option(name string) string {
+	value, ok := p.Options[name]
+	if !ok || value == nil {
+		return ""
+	}
+
+	return fmt.Sprint(value)
 }
 
 func (p *Portfolio) SyncWith(record *Portfolio) {
 	p.HistoryScraped = record.HistoryScraped
+	p.IncomeCursor = record.IncomeCursor
+	p.TransferCursor = record.TransferCursor
+	p.IncomeHistoryCursor = record.IncomeHistoryCursor
+	p.BalancesDerived = record.BalancesDerived
 }
 
 type ScrapeCtx struct {
@@ -25,9 +64,11 @@ type ScrapeCtx struct {
 	Portfolio   *Portfolio  `gorm:"foreignkey:PortfolioID"`
 	PortfolioID PortfolioID `gorm:"type:varchar(50)"`
 
-	WeightUsed  int32         `gorm:"-"`
-	WeightLimit int32         `gorm:"-"`
-	Cooldown    time.Duration `gorm:"-"`
+	Weight WeightLimiter `gorm:"-"`
+
+	// weightUsed is the weight reserved through this context, of the
+	// budget it shares with other contexts
+	weightUsed int64
 }
 
 func (p *ScrapeCtx) Apply(ctx *ScrapeCtx) {
@@ -35,7 +76,54 @@ func (p *ScrapeCtx) Apply(ctx *ScrapeCtx) {
 	p.Portfolio = ctx.Portfolio
 	p.PortfolioID = ctx.PortfolioID
 
-	p.WeightUsed = ctx.WeightUsed
+	p.Weight = ctx.Weight
+}
+
+// ReserveWeight blocks until the weight fits into the budget, and counts
+// it as used by this context. It gives up once ctx is done.
+func (p *ScrapeCtx) ReserveWeight(ctx context.Context, weight int32) error {
+	if err := p.Weight.Reserve(ctx, weight); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&p.weightUsed, int64(weight))
+	return nil
+}
+
+// WeightUsed returns the weight reserved through this context.
+func (p *ScrapeCtx) WeightUsed() int64 {
+	return atomic.LoadInt64(&p.weightUsed)
+}
+
+// KeyedScrapeCtx is the scrape context of records whose IDs the exchange
+// only keeps unique within an account, such as orders and trades. It makes the
+// portfolio part of their primary key, which gorm cannot do for a field of
+// an embedded ScrapeCtx.
+type KeyedScrapeCtx struct {
+	ScrapedAt   int64       `gorm:"type:bigint"`
+	Portfolio   *Portfolio  `gorm:"foreignkey:PortfolioID"`
+	PortfolioID PortfolioID `gorm:"primaryKey;type:varchar(50)"`
+}
+
+func (p *KeyedScrapeCtx) Apply(ctx *ScrapeCtx) {
+	p.ScrapedAt = ctx.ScrapedAt
+	p.Portfolio = ctx.Portfolio
+	p.PortfolioID = ctx.PortfolioID
+}
+
+// WeightLimiter limits the exchange request weight used by every
+// portfolio that shares the same API key. It is implemented by
+// exchange.WeightBudget.
+type WeightLimiter interface {
+	// Reserve blocks until the weight fits into the budget, or until ctx
+	// is done.
+	Reserve(ctx context.Context, weight int32) error
+	// Sync updates the budget with the weight reported by the exchange.
+	Sync(used int32)
+	// Backoff blocks all reservations for the given duration.
+	Backoff(d time.Duration)
+	Used() int32
+	Limit() int32
 }
 
 type Position struct {
@@ -57,23 +145,64 @@ func (p *Position) IsOpen() bool {
 	return math.Abs(p.Amount) > 0.0
 }
 
+// PositionSnapshot is a position as it was at ScrapedAt. Unlike Position,
+// which only holds the current state, snapshots are appended every scrape.
+type PositionSnapshot struct {
+	Position
+}
+
+func NewPositionSnapshot(position *Position) *PositionSnapshot {
+	snapshot := &PositionSnapshot{Position: *position}
+	snapshot.ID = 0
+
+	return snapshot
+}
+
+const (
+	OrderStatusNew             = "NEW"
+	OrderStatusPartiallyFilled = "PARTIALLY_FILLED"
+	OrderStatusFilled          = "FILLED"
+	OrderStatusCanceled        = "CANCELED"
+	OrderStatusExpired         = "EXPIRED"
+	OrderStatusRejected        = "REJECTED"
+	// OrderStatusUnknown marks orders the exchange no longer reports.
+	OrderStatusUnknown = "UNKNOWN"
+)
+
 type Order struct {
-	ScrapeCtx
+	KeyedScrapeCtx
 
-	ID           int64     `gorm:"primaryKey; autoIncrement:false; type:bigint"`
-	Symbol       string    `gorm:"type:varchar(20)"`
-	Side         string    `gorm:"type:varchar(7)"`
-	PositionSide string    `gorm:"type:varchar(7)"`
-	TimeInForce  string    `gorm:"type:varchar(7)"`
-	Type         string    `gorm:"type:varchar(7)"`
-	Price        float64   `gorm:"type:float"`
-	Amount       float64   `gorm:"type:float"`
-	ReduceOnly   bool      `gorm:"type:bool"`
-	Date         time.Time `gorm:"type:date"`
+	ID             int64     `gorm:"primaryKey; autoIncrement:false; type:bigint"`
+	ExternalID     string    `gorm:"type:varchar(50)"`
+	Symbol         string    `gorm:"primaryKey; type:varchar(20)"`
+	Side           string    `gorm:"type:varchar(7)"`
+	PositionSide   string    `gorm:"type:varchar(7)"`
+	TimeInForce    string    `gorm:"type:varchar(7)"`
+	Type           string    `gorm:"type:varchar(7)"`
+	Status         string    `gorm:"type:varchar(20)"`
+	Price          float64   `gorm:"type:float"`
+	AvgPrice       float64   `gorm:"type:float"`
+	Amount         float64   `gorm:"type:float"`
+	ExecutedAmount float64   `gorm:"type:float"`
+	ReduceOnly     bool      `gorm:"type:bool"`
+	Date           time.Time `gorm:"type:date"`
+	UpdateDate     time.Time `gorm:"type:date"`
+}
+
+func (o *Order) IsOpen() bool {
+	return o.Status == OrderStatusNew || o.Status == OrderStatusPartiallyFilled
+}
+
+// Normalized is the value of a record in a reporting currency. It is
+// worked out when records are read, and is not stored.
+type Normalized struct {
+	Currency string  `gorm:"-"`
+	Value    float64 `gorm:"-"`
 }
 
 type Income struct {
 	ScrapeCtx
+	Normalized
 
 	ID      int64     `gorm:"primaryKey; autoIncrement:false; type:bigint"`
 	Type    string    `gorm:"primaryKey; type:varchar(20)"`
@@ -83,27 +212,380 @@ type Income struct {
 	Income  float64   `gorm:"type:float"`
 	TradeID int64     `gorm:"type:bigint"`
 	Date    time.Time `gorm:"type:date"`
+
+	// QuoteIncome is Income valued in QuoteAsset, or nil until there is a
+	// price to value it with.
+	QuoteIncome *float64 `gorm:"type:float"`
 }
 
+// Transfer types, as seen from the portfolio the transfer belongs to.
+const (
+	TransferDeposit    = "DEPOSIT"
+	TransferWithdrawal = "WITHDRAWAL"
+	TransferIn         = "TRANSFER_IN"
+	TransferOut        = "TRANSFER_OUT"
+)
+
+// Transfer is a deposit, withdrawal or transfer into or out of a
+// portfolio. Transfers between configured portfolios are internal and
+// link to the portfolio on the other side, so they can be told apart from
+// external flows.
+type Transfer struct {
+	ScrapeCtx
+	Normalized
+
+	ID         uint   `gorm:"primaryKey"`
+	ExternalID string `gorm:"type:varchar(100)"`
+	Type       string `gorm:"type:varchar(20)"`
+	Asset      string `gorm:"type:varchar(20)"`
+	// Amount is positive for flows into the portfolio and includes fees.
+	Amount float64 `gorm:"type:float"`
+	// QuoteAmount is Amount valued in QuoteAsset, or nil until there is a
+	// price to value it with.
+	QuoteAmount    *float64    `gorm:"type:float"`
+	Internal       bool        `gorm:"type:bool;default:false"`
+	CounterpartyID PortfolioID `gorm:"type:varchar(50)"`
+	Date           time.Time   `gorm:"type:date"`
+}
+
+type Trade struct {
+	KeyedScrapeCtx
+
+	ID              int64     `gorm:"primaryKey; autoIncrement:false; type:bigint"`
+	Symbol          string    `gorm:"primaryKey; type:varchar(20)"`
+	OrderID         int64     `gorm:"type:bigint"`
+	Side            string    `gorm:"type:varchar(7)"`
+	PositionSide    string    `gorm:"type:varchar(7)"`
+	Price           float64   `gorm:"type:float"`
+	Amount          float64   `gorm:"type:float"`
+	QuoteAmount     float64   `gorm:"type:float"`
+	Commission      float64   `gorm:"type:float"`
+	CommissionAsset string    `gorm:"type:varchar(20)"`
+	RealizedPnl     float64   `gorm:"type:float"`
+	Buyer           bool      `gorm:"type:bool"`
+	Maker           bool      `gorm:"type:bool"`
+	Date            time.Time `gorm:"type:date"`
+}
+
+// Histories kept per symbol, with a HistoryCursor each.
+const (
+	HistoryTrades = "trades"
+	HistoryOrders = "orders"
+)
+
+// HistoryCursor is the time the history of a symbol of a portfolio was
+// last scraped up to. It is kept even when nothing was found, so ranges
+// already scraped are not scraped again.
+type HistoryCursor struct {
+	PortfolioID PortfolioID `gorm:"primaryKey;type:varchar(50)"`
+	History     string      `gorm:"primaryKey;type:varchar(20)"`
+	Symbol      string      `gorm:"primaryKey;type:varchar(20)"`
+	Cursor      int64       `gorm:"type:bigint"`
+}
+
+// DailyBalance holds the wallet balance of one margin asset. AssetBalance
+// is denominated in Asset, Balance is valued in QuoteAsset. Derived
+// balances were not observed, but worked out from income and transfers.
 type DailyBalance struct {
 	ScrapeCtx
+	Normalized
 
-	ID      uint      `gorm:"primaryKey"`
-	Balance float64   `gorm:"type:float"`
-	Date    time.Time `gorm:"type:date"`
+	ID           uint      `gorm:"primaryKey"`
+	Asset        string    `gorm:"type:varchar(20)"`
+	AssetBalance float64   `gorm:"type:float"`
+	Balance      float64   `gorm:"type:float"`
+	Derived      bool      `gorm:"type:bool;default:false"`
+	Date         time.Time `gorm:"type:date"`
 }
 
 type CurrentBalance struct {
 	ScrapeCtx
 
-	ID      uint      `gorm:"primaryKey"`
-	Balance float64   `gorm:"type:float"`
-	Date    time.Time `gorm:"type:date"`
+	ID           uint      `gorm:"primaryKey"`
+	Asset        string    `gorm:"type:varchar(20)"`
+	AssetBalance float64   `gorm:"type:float"`
+	Balance      float64   `gorm:"type:float"`
+	Date         time.Time `gorm:"type:date"`
+}
+
+// AccountSnapshot is the margin state of an account at ScrapedAt. Its
+// figures are in Asset: the margin asset of single-asset accounts, or the
+// currency the exchange values multi-asset accounts in.
+type AccountSnapshot struct {
+	ScrapeCtx
+
+	ID               uint      `gorm:"primaryKey"`
+	Asset            string    `gorm:"type:varchar(20)"`
+	WalletBalance    float64   `gorm:"type:float"`
+	UnrealizedPnl    float64   `gorm:"type:float"`
+	MarginBalance    float64   `gorm:"type:float"`
+	AvailableBalance float64   `gorm:"type:float"`
+	InitialMargin    float64   `gorm:"type:float"`
+	MaintMargin      float64   `gorm:"type:float"`
+	Date             time.Time `gorm:"type:date"`
+
+	Assets []*AssetBalance `gorm:"foreignKey:AccountSnapshotID"`
 }
 
+// MarginRatio returns the share of the margin balance taken up by the
+// maintenance margin. Positions are liquidated once it reaches 1.
+func (a *AccountSnapshot) MarginRatio() float64 {
+	return marginRatio(a.MaintMargin, a.MarginBalance)
+}
+
+// AssetBalance is the balance of one asset of an AccountSnapshot, in that
+// asset.
+type AssetBalance struct {
+	ScrapeCtx
+
+	ID                uint      `gorm:"primaryKey"`
+	AccountSnapshotID uint      `gorm:"index"`
+	Asset             string    `gorm:"type:varchar(20)"`
+	WalletBalance     float64   `gorm:"type:float"`
+	UnrealizedPnl     float64   `gorm:"type:float"`
+	MarginBalance     float64   `gorm:"type:float"`
+	AvailableBalance  float64   `gorm:"type:float"`
+	InitialMargin     float64   `gorm:"type:float"`
+	MaintMargin       float64   `gorm:"type:float"`
+	Date              time.Time `gorm:"type:date"`
+}
+
+// MarginRatio is the margin ratio of the asset, for exchanges that margin
+// every asset separately.
+func (a *AssetBalance) MarginRatio() float64 {
+	return marginRatio(a.MaintMargin, a.MarginBalance)
+}
+
+// IsEmpty reports whether the account holds none of the asset.
+func (a *AssetBalance) IsEmpty() bool {
+	return a.WalletBalance == 0 && a.MarginBalance == 0
+}
+
+func marginRatio(maintMargin, marginBalance float64) float64 {
+	if maintMargin == 0 {
+		return 0
+	}
+
+	if marginBalance <= 0 {
+		return math.Inf(1)
+	}
+
+	return maintMargin / marginBalance
+}
+
+// SymbolPrice is the latest price of a symbol on an exchange.
 type SymbolPrice struct {
 	ScrapeCtx
 
-	Symbol string  `gorm:"primaryKey;type:varchar(20)"`
-	Price  float64 `gorm:"type:float"`
+	Exchange string  `gorm:"primaryKey;type:varchar(50)"`
+	Symbol   string  `gorm:"primaryKey;type:varchar(20)"`
+	Price    float64 `gorm:"type:float"`
+}
+
+// PriceSample is the price of a symbol on an exchange, sampled once per
+// window of the price history resolution starting at Date.
+type PriceSample struct {
+	Exchange string    `gorm:"primaryKey;type:varchar(50)"`
+	Symbol   string    `gorm:"primaryKey;type:varchar(20)"`
+	Date     time.Time `gorm:"primaryKey"`
+	Price    float64   `gorm:"type:float"`
+}
+
+// CandleIntervals are the supported candle intervals, by name.
+var CandleIntervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"30m": 30 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// Candle is an OHLCV candle of a symbol on an exchange. Volume is in the
+// base asset of the symbol, QuoteVolume in its quote asset. The latest
+// candle of a symbol may still be open, and is updated by the next scrape.
+type Candle struct {
+	Exchange    string    `gorm:"primaryKey;type:varchar(50)"`
+	Symbol      string    `gorm:"primaryKey;type:varchar(20)"`
+	Interval    string    `gorm:"primaryKey;type:varchar(5)"`
+	OpenTime    time.Time `gorm:"primaryKey"`
+	Open        float64   `gorm:"type:float"`
+	High        float64   `gorm:"type:float"`
+	Low         float64   `gorm:"type:float"`
+	Close       float64   `gorm:"type:float"`
+	Volume      float64   `gorm:"type:float"`
+	QuoteVolume float64   `gorm:"type:float"`
+}
+
+// FundingRate is the funding rate of a perpetual symbol on an exchange, as
+// published for its funding time, and the mark price at that time.
+type FundingRate struct {
+	Exchange  string    `gorm:"primaryKey;type:varchar(50)"`
+	Symbol    string    `gorm:"primaryKey;type:varchar(20)"`
+	Date      time.Time `gorm:"primaryKey"`
+	Rate      float64   `gorm:"type:float"`
+	MarkPrice float64   `gorm:"type:float"`
+}
+
+// Payment returns the funding a position of the amount, in the base asset
+// and negative when short, received at the rate. Longs pay shorts when the
+// rate is positive. The payment is in the quote asset, so it only explains
+// FUNDING_FEE income of linear contracts.
+func (f *FundingRate) Payment(amount float64) float64 {
+	return -amount * f.MarkPrice * f.Rate
+}
+
+// Symbol statuses, normalized across exchanges.
+const (
+	SymbolStatusPending   = "PENDING"
+	SymbolStatusTrading   = "TRADING"
+	SymbolStatusHalted    = "HALTED"
+	SymbolStatusDelisting = "DELISTING"
+	SymbolStatusDelisted  = "DELISTED"
+)
+
+// SymbolInfo holds the trading rules and listing status of a symbol on an
+// exchange. TickSize and LotSize are the steps of prices and amounts, with
+// amounts in the unit the exchange's positions and orders are stored in.
+// MinNotional is in QuoteAsset, and is zero when the exchange sets none.
+type SymbolInfo struct {
+	Exchange     string    `gorm:"primaryKey;type:varchar(50)"`
+	Symbol       string    `gorm:"primaryKey;type:varchar(20)"`
+	BaseAsset    string    `gorm:"type:varchar(20)"`
+	QuoteAsset   string    `gorm:"type:varchar(20)"`
+	MarginAsset  string    `gorm:"type:varchar(20)"`
+	ContractType string    `gorm:"type:varchar(20)"`
+	TickSize     float64   `gorm:"type:float"`
+	LotSize      float64   `gorm:"type:float"`
+	MinNotional  float64   `gorm:"type:float"`
+	Status       string    `gorm:"type:varchar(10)"`
+	ListDate     time.Time `gorm:"type:date"`
+	// DelistDate is when a symbol that is being delisted stops trading, or
+	// when a dated contract is delivered.
+	DelistDate time.Time `gorm:"type:date"`
+	ScrapedAt  int64     `gorm:"type:bigint"`
+}
+
+// IsDelisting reports whether the symbol is being or has been delisted.
+func (s *SymbolInfo) IsDelisting() bool {
+	return s.Status == SymbolStatusDelisting || s.Status == SymbolStatusDelisted
+}
+
+// RoundPrice rounds the price to the tick size of the symbol.
+func (s *SymbolInfo) RoundPrice(price float64) float64 {
+	return roundToStep(price, s.TickSize)
+}
+
+// RoundAmount rounds the amount to the lot size of the symbol.
+func (s *SymbolInfo) RoundAmount(amount float64) float64 {
+	return roundToStep(amount, s.LotSize)
+}
+
+func roundToStep(value, step float64) float64 {
+	if step <= 0 {
+		return value
+	}
+
+	// multiples of steps like 0.1 are not exact in binary, so the result is
+	// rounded to the decimals of the step
+	decimals := 0
+	formatted := strconv.FormatFloat(step, 'f', -1, 64)
+	if i := strings.IndexByte(formatted, '.'); i >= 0 {
+		decimals = len(formatted) - i - 1
+	}
+
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(math.Round(value/step)*step*scale) / scale
+}
+
+// ScrapeRun is one scrape of all portfolios. Error is set when the run
+// failed as a whole, failures of single tasks are in their results.
+type ScrapeRun struct {
+	ID        uint      `gorm:"primaryKey"`
+	StartedAt time.Time `gorm:"index"`
+	EndedAt   time.Time
+	Error     string `gorm:"type:text"`
+
+	Tasks []*ScrapeTaskResult `gorm:"foreignKey:RunID"`
+}
+
+// ScrapeTaskResult is the outcome of one task of a scrape run for one
+// portfolio. Market data tasks run for one portfolio of every exchange.
+// Weight is the request weight the task used, Rows the rows it wrote, both
+// over all Attempts. Skipped tasks may carry the reason in Error.
+type ScrapeTaskResult struct {
+	ID          uint        `gorm:"primaryKey"`
+	RunID       uint        `gorm:"index"`
+	PortfolioID PortfolioID `gorm:"type:varchar(50);index"`
+	Task        string      `gorm:"type:varchar(20)"`
+	StartedAt   time.Time
+	EndedAt     time.Time
+	Attempts    int    `gorm:"type:int"`
+	Rows        int64  `gorm:"type:bigint"`
+	Weight      int64  `gorm:"type:bigint"`
+	Skipped     bool   `gorm:"type:bool;default:false"`
+	Error       string `gorm:"type:text"`
+}
+
+func (r *ScrapeTaskResult) Succeeded() bool {
+	return !r.Skipped && r.Error == ""
+}
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// PortfolioBreaker is the circuit breaker of a portfolio. It opens once
+// Failures scrapes in a row failed, pausing scrapes of the portfolio until
+// RetryAt. The next scrape is then let through half-open, and closes the
+// breaker if it succeeds or opens it again if not.
+type PortfolioBreaker struct {
+	PortfolioID PortfolioID `gorm:"primaryKey;type:varchar(50)"`
+	State       string      `gorm:"type:varchar(10)"`
+	Failures    int         `gorm:"type:int"`
+	LastError   string      `gorm:"type:text"`
+	OpenedAt    time.Time
+	RetryAt     time.Time
+	UpdatedAt   time.Time
+}
+
+func NewPortfolioBreaker(portfolioID PortfolioID) *PortfolioBreaker {
+	return &PortfolioBreaker{PortfolioID: portfolioID, State: BreakerClosed}
+}
+
+// Allow reports whether the portfolio may be scraped at now. An open
+// breaker past RetryAt turns half-open to let one scrape through.
+func (b *PortfolioBreaker) Allow(now time.Time) bool {
+	if b.State == BreakerOpen && !now.Before(b.RetryAt) {
+		b.State = BreakerHalfOpen
+	}
+
+	return b.State != BreakerOpen
+}
+
+// Record records the outcome of a scrape at now, opening the breaker for
+// cooldown after threshold failures in a row, or after a failed scrape
+// while half-open. A threshold of 0 never opens it. It returns whether the
+// state changed.
+func (b *PortfolioBreaker) Record(err error, threshold int, cooldown time.Duration, now time.Time) bool {
+	state := b.State
+	if err == nil {
+		b.State = BreakerClosed
+		b.Failures = 0
+		b.LastError = ""
+		return b.State != state
+	}
+
+	b.Failures++
+	b.LastError = err.Error()
+	if threshold > 0 && (b.State == BreakerHalfOpen || b.Failures >= threshold) {
+		b.State = BreakerOpen
+		b.OpenedAt = now
+		b.RetryAt = now.Add(cooldown)
+	}
+
+	return b.State != state
 }
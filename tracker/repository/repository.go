@@ -11,22 +11,76 @@ type Repository interface {
 
 type Reader interface {
 	GetPositions() ([]*model.Position, error)
+	GetPositionSnapshotsBetween(start, end int64) ([]*model.PositionSnapshot, error)
 	GetPortfolios() ([]*model.Portfolio, error)
 	GetOrders() ([]*model.Order, error)
+	GetOpenOrders(portfolio *model.Portfolio) ([]*model.Order, error)
+	GetOrder(portfolio *model.Portfolio, symbol string, id int64) (*model.Order, error)
+	GetLatestOrder(portfolio *model.Portfolio, symbol string) (*model.Order, error)
 	GetIncomeBetween(start, end int64) ([]*model.Income, error)
+	GetExternalTransfersBetween(start, end int64) ([]*model.Transfer, error)
+	GetSymbolPrice(exchange, symbol string) (*model.SymbolPrice, error)
+	GetPriceAt(exchange, symbol string, at int64) (*model.PriceSample, error)
+	GetPriceSamplesBetween(exchange, symbol string, start, end int64) ([]*model.PriceSample, error)
+	GetEarliestTradeIncome(portfolio *model.Portfolio, symbol string) (*model.Income, error)
+	GetTradeIncome(trade *model.Trade) ([]*model.Income, error)
+	GetLatestTrade(portfolio *model.Portfolio, symbol string) (*model.Trade, error)
+	GetHistoryCursor(portfolio *model.Portfolio, history, symbol string) (*model.HistoryCursor, error)
+	GetTradedSymbols(portfolio *model.Portfolio) ([]string, error)
+	GetEarliestIncome(portfolio *model.Portfolio) (*model.Income, error)
+	GetUnvaluedIncome(portfolio *model.Portfolio) ([]*model.Income, error)
+	GetPortfolioIncomeBetween(portfolio *model.Portfolio, start, end int64) ([]*model.Income, error)
+	GetTransfersBetween(portfolio *model.Portfolio, start, end int64) ([]*model.Transfer, error)
+	GetDailyBalancesBetween(portfolio *model.Portfolio, start, end int64) ([]*model.DailyBalance, error)
+	GetCurrentBalances(portfolio *model.Portfolio) ([]*model.CurrentBalance, error)
+	GetUnlinkedTransfers(portfolio *model.Portfolio, start int64) ([]*model.Transfer, error)
+	GetUnvaluedTransfers(portfolio *model.Portfolio) ([]*model.Transfer, error)
+	GetCounterTransfer(transfer *model.Transfer) (*model.Transfer, error)
+	GetNetDeposits(portfolio *model.Portfolio, start, end int64) (float64, error)
+	GetPosition(portfolio *model.Portfolio, symbol, side string) (*model.Position, error)
+	GetPositionSnapshotsAt(portfolio *model.Portfolio, symbol string, at int64) ([]*model.PositionSnapshot, error)
+	GetLatestCandle(exchange, symbol, interval string) (*model.Candle, error)
+	GetCandlesBetween(exchange, symbol, interval string, start, end int64) ([]*model.Candle, error)
+	GetFundingSymbols(portfolio *model.Portfolio) ([]string, error)
+	GetEarliestFundingIncome(portfolio *model.Portfolio, symbol string) (*model.Income, error)
+	GetLatestFundingRate(exchange, symbol string) (*model.FundingRate, error)
+	GetFundingRateAt(exchange, symbol string, at int64) (*model.FundingRate, error)
+	GetSymbolInfo(exchange, symbol string) (*model.SymbolInfo, error)
+	GetSymbolInfos(exchange string) ([]*model.SymbolInfo, error)
+	GetDelistingPositions() ([]*model.Position, error)
+	GetLatestAccountSnapshot(portfolio *model.Portfolio) (*model.AccountSnapshot, error)
+	GetAccountSnapshotsBetween(portfolio *model.Portfolio, start, end int64) ([]*model.AccountSnapshot, error)
+	GetScrapeRunsBetween(start, end int64) ([]*model.ScrapeRun, error)
+	GetLatestTaskResult(portfolio *model.Portfolio, task string) (*model.ScrapeTaskResult, error)
+	GetLatestSuccessfulTaskResult(portfolio *model.Portfolio, task string) (*model.ScrapeTaskResult, error)
+	GetPortfolioBreaker(portfolio *model.Portfolio) (*model.PortfolioBreaker, error)
+	GetPortfolioBreakers() ([]*model.PortfolioBreaker, error)
 }
 
 type Writer interface {
 	SyncPortfolio(portfolio *model.Portfolio) error
 	UpdatePortfolio(portfolio *model.Portfolio) error
 
-	CreateSymbolPrice(price *model.SymbolPrice) error
+	CreateSymbolPrices(prices []*model.SymbolPrice) error
+	CreatePriceSamples(samples []*model.PriceSample) error
 	CreatePosition(position *model.Position) error
+	ReplacePosition(position *model.Position) error
+	ReplacePositions(portfolio *model.Portfolio, positions []*model.Position) error
+	CreatePositionSnapshot(snapshot *model.PositionSnapshot) error
+	CreateAccountSnapshot(snapshot *model.AccountSnapshot) error
 	CreateOrder(order *model.Order) error
 	CreateIncome(income *model.Income) error
+	CreateTrade(trade *model.Trade) error
+	SaveHistoryCursor(cursor *model.HistoryCursor) error
+	CreateTransfer(transfer *model.Transfer) error
+	LinkTransfers(transfer, counter *model.Transfer) error
 	CreateDailyBalance(balance *model.DailyBalance) error
+	CreateCandles(candles []*model.Candle) error
+	CreateFundingRates(rates []*model.FundingRate) error
+	UpdateSymbolInfos(exchange string, infos []*model.SymbolInfo) error
 	UpdateCurrentBalance(balance *model.CurrentBalance) error
-
-	RemoveAllPositions(portfolio *model.Portfolio) error
-	RemoveAllOrders(portfolio *model.Portfolio) error
+	CreateScrapeRun(run *model.ScrapeRun) error
+	UpdateScrapeRun(run *model.ScrapeRun) error
+	CreateScrapeTaskResult(result *model.ScrapeTaskResult) error
+	SavePortfolioBreaker(breaker *model.PortfolioBreaker) error
 }
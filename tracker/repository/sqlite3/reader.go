@@ -1,7 +1,12 @@
 package sqlite3
 
 import (
+	"errors"
+	"math"
+	"time"
+
 	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"gorm.io/gorm"
 )
 
 func (r *repo) GetPortfolios() ([]*model.Portfolio, error) {
@@ -22,6 +27,62 @@ func (r *repo) GetPositions() ([]*model.Position, error) {
 	return positions, nil
 }
 
+func (r *repo) GetPositionSnapshotsBetween(start, end int64) ([]*model.PositionSnapshot, error) {
+	var snapshots []*model.PositionSnapshot
+	err := r.db.
+		Where("scraped_at >= ? AND scraped_at <= ?", start, end).
+		Order("scraped_at").
+		Find(&snapshots).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+func (r *repo) GetPosition(portfolio *model.Portfolio, symbol, side string) (*model.Position, error) {
+	position := &model.Position{}
+	err := r.db.
+		Where("portfolio_id = ? AND symbol = ? AND side = ?", portfolio.ID, symbol, side).
+		First(position).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return position, nil
+}
+
+// GetPositionSnapshotsAt returns the snapshots of the symbol's positions
+// taken by the last scrape of the portfolio before at, one per position
+// side.
+func (r *repo) GetPositionSnapshotsAt(portfolio *model.Portfolio, symbol string, at int64) ([]*model.PositionSnapshot, error) {
+	var scrapedAt int64
+	err := r.db.Model(&model.PositionSnapshot{}).
+		Where("portfolio_id = ? AND symbol = ? AND scraped_at <= ?", portfolio.ID, symbol, at).
+		Select("COALESCE(MAX(scraped_at), 0)").
+		Scan(&scrapedAt).
+		Error
+	if err != nil || scrapedAt == 0 {
+		return nil, err
+	}
+
+	var snapshots []*model.PositionSnapshot
+	err = r.db.
+		Where("portfolio_id = ? AND symbol = ? AND scraped_at = ?", portfolio.ID, symbol, scrapedAt).
+		Find(&snapshots).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
 func (r *repo) GetOrders() ([]*model.Order, error) {
 	var orders []*model.Order
 	if err := r.limitedDB().Find(&orders).Error; err != nil {
@@ -31,10 +92,171 @@ func (r *repo) GetOrders() ([]*model.Order, error) {
 	return orders, nil
 }
 
+// GetOpenOrders returns orders last seen open, including orders stored
+// before their status was tracked.
+func (r *repo) GetOpenOrders(portfolio *model.Portfolio) ([]*model.Order, error) {
+	var orders []*model.Order
+	err := r.db.
+		Where("portfolio_id = ? AND (status IN ? OR status IS NULL OR status = '')",
+			portfolio.ID, []string{model.OrderStatusNew, model.OrderStatusPartiallyFilled}).
+		Find(&orders).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (r *repo) GetOrder(portfolio *model.Portfolio, symbol string, id int64) (*model.Order, error) {
+	order := &model.Order{}
+	err := r.db.
+		Where("portfolio_id = ? AND symbol = ? AND id = ?", portfolio.ID, symbol, id).
+		First(order).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetLatestOrder returns the order of the symbol last updated. Order IDs
+// are not in time order on every exchange, so it is picked by time.
+func (r *repo) GetLatestOrder(portfolio *model.Portfolio, symbol string) (*model.Order, error) {
+	order := &model.Order{}
+	err := r.db.
+		Where("portfolio_id = ? AND symbol = ?", portfolio.ID, symbol).
+		Order("update_date DESC, date DESC").
+		First(order).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetIncomeBetween returns income of all portfolios between start and end.
+// Income of type TRANSFER is left out, as it is not earned: transfers are
+// read with GetExternalTransfersBetween and GetNetDeposits.
 func (r *repo) GetIncomeBetween(start, end int64) ([]*model.Income, error) {
 	var incomes []*model.Income
 	err := r.limitedDB().
-		Where("(type <> 'TRANSFER' OR type is null) AND  timestamp >= ? AND timestamp <= ?", start, end).
+		Where("(type <> 'TRANSFER' OR type is null) AND date >= ? AND date <= ?", time.UnixMilli(start), time.UnixMilli(end)).
+		Order("date").
+		Find(&incomes).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return incomes, nil
+}
+
+func (r *repo) GetEarliestIncome(portfolio *model.Portfolio) (*model.Income, error) {
+	income := &model.Income{}
+	err := r.db.
+		Where("portfolio_id = ?", portfolio.ID).
+		Order("date").
+		First(income).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return income, nil
+}
+
+// GetUnvaluedIncome returns income of the portfolio stored without a
+// model.QuoteAsset value, as its asset had no price.
+func (r *repo) GetUnvaluedIncome(portfolio *model.Portfolio) ([]*model.Income, error) {
+	var incomes []*model.Income
+	err := r.db.
+		Where("portfolio_id = ? AND quote_income IS NULL", portfolio.ID).
+		Order("date").
+		Find(&incomes).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return incomes, nil
+}
+
+// GetPortfolioIncomeBetween returns all income of the portfolio between
+// start and end, oldest first.
+func (r *repo) GetPortfolioIncomeBetween(portfolio *model.Portfolio, start, end int64) ([]*model.Income, error) {
+	var incomes []*model.Income
+	err := r.db.
+		Where("portfolio_id = ? AND date >= ? AND date <= ?", portfolio.ID, time.UnixMilli(start), time.UnixMilli(end)).
+		Order("date").
+		Find(&incomes).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return incomes, nil
+}
+
+func (r *repo) GetDailyBalancesBetween(portfolio *model.Portfolio, start, end int64) ([]*model.DailyBalance, error) {
+	var balances []*model.DailyBalance
+	err := r.db.
+		Where("portfolio_id = ? AND date >= ? AND date <= ?", portfolio.ID, time.UnixMilli(start), time.UnixMilli(end)).
+		Order("date").
+		Find(&balances).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+func (r *repo) GetCurrentBalances(portfolio *model.Portfolio) ([]*model.CurrentBalance, error) {
+	var balances []*model.CurrentBalance
+	err := r.db.
+		Where("portfolio_id = ?", portfolio.ID).
+		Find(&balances).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+func (r *repo) GetEarliestTradeIncome(portfolio *model.Portfolio, symbol string) (*model.Income, error) {
+	income := &model.Income{}
+	err := r.db.
+		Where("portfolio_id = ? AND symbol = ? AND trade_id > 0", portfolio.ID, symbol).
+		Order("date").
+		First(income).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return income, nil
+}
+
+func (r *repo) GetTradeIncome(trade *model.Trade) ([]*model.Income, error) {
+	var incomes []*model.Income
+	err := r.db.
+		Where("portfolio_id = ? AND symbol = ? AND trade_id = ?", trade.PortfolioID, trade.Symbol, trade.ID).
 		Find(&incomes).
 		Error
 	if err != nil {
@@ -43,3 +265,526 @@ func (r *repo) GetIncomeBetween(start, end int64) ([]*model.Income, error) {
 
 	return incomes, nil
 }
+
+// GetLatestTrade returns the most recent trade of the symbol. Trade IDs
+// are not in time order on every exchange, so it is picked by time.
+func (r *repo) GetLatestTrade(portfolio *model.Portfolio, symbol string) (*model.Trade, error) {
+	trade := &model.Trade{}
+	err := r.db.
+		Where("portfolio_id = ? AND symbol = ?", portfolio.ID, symbol).
+		Order("date DESC").
+		First(trade).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return trade, nil
+}
+
+func (r *repo) GetHistoryCursor(portfolio *model.Portfolio, history, symbol string) (*model.HistoryCursor, error) {
+	cursor := &model.HistoryCursor{}
+	err := r.db.
+		Where("portfolio_id = ? AND history = ? AND symbol = ?", portfolio.ID, history, symbol).
+		First(cursor).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return cursor, nil
+}
+
+func (r *repo) GetTradedSymbols(portfolio *model.Portfolio) ([]string, error) {
+	var incomeSymbols []string
+	err := r.db.Model(&model.Income{}).
+		Where("portfolio_id = ? AND trade_id > 0", portfolio.ID).
+		Distinct().
+		Pluck("symbol", &incomeSymbols).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var positionSymbols []string
+	err = r.db.Model(&model.Position{}).
+		Where("portfolio_id = ?", portfolio.ID).
+		Distinct().
+		Pluck("symbol", &positionSymbols).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var orderSymbols []string
+	err = r.db.Model(&model.Order{}).
+		Where("portfolio_id = ?", portfolio.ID).
+		Distinct().
+		Pluck("symbol", &orderSymbols).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var tradeSymbols []string
+	err = r.db.Model(&model.Trade{}).
+		Where("portfolio_id = ?", portfolio.ID).
+		Distinct().
+		Pluck("symbol", &tradeSymbols).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return uniqueStrings(incomeSymbols, positionSymbols, orderSymbols, tradeSymbols), nil
+}
+
+func uniqueStrings(lists ...[]string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, list := range lists {
+		for _, s := range list {
+			if s == "" || seen[s] {
+				continue
+			}
+
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// GetSymbolPrice returns the latest price of the symbol on the exchange,
+// or on any exchange when exchange is empty.
+func (r *repo) GetSymbolPrice(exchange, symbol string) (*model.SymbolPrice, error) {
+	query := r.db.Where("symbol = ?", symbol)
+	if exchange != "" {
+		query = query.Where("exchange = ?", exchange)
+	}
+
+	price := &model.SymbolPrice{}
+	if err := query.Order("scraped_at DESC").First(price).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return price, nil
+}
+
+// GetPriceAt returns the last price sample of the symbol on the exchange,
+// or on any exchange when exchange is empty, taken no later than at.
+func (r *repo) GetPriceAt(exchange, symbol string, at int64) (*model.PriceSample, error) {
+	query := r.db.Where("symbol = ? AND date <= ?", symbol, time.UnixMilli(at))
+	if exchange != "" {
+		query = query.Where("exchange = ?", exchange)
+	}
+
+	sample := &model.PriceSample{}
+	if err := query.Order("date DESC").First(sample).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return sample, nil
+}
+
+func (r *repo) GetPriceSamplesBetween(exchange, symbol string, start, end int64) ([]*model.PriceSample, error) {
+	var samples []*model.PriceSample
+	err := r.db.
+		Where("exchange = ? AND symbol = ? AND date >= ? AND date <= ?", exchange, symbol, time.UnixMilli(start), time.UnixMilli(end)).
+		Order("date").
+		Find(&samples).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+const (
+	// transferMatchWindow is how far apart in time the two sides of a
+	// transfer between portfolios may be recorded.
+	transferMatchWindow = 3 * time.Hour
+	// transferMatchTolerance is the relative difference allowed between
+	// the amounts of the two sides, which covers withdrawal fees.
+	transferMatchTolerance = 0.001
+)
+
+func (r *repo) GetTransfersBetween(portfolio *model.Portfolio, start, end int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	err := r.db.
+		Where("portfolio_id = ? AND date >= ? AND date <= ?", portfolio.ID, time.UnixMilli(start), time.UnixMilli(end)).
+		Order("date").
+		Find(&transfers).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// GetExternalTransfersBetween returns the transfers of all portfolios
+// between start and end that moved funds in from or out to somewhere other
+// than another portfolio, so they are not counted as profit or loss.
+func (r *repo) GetExternalTransfersBetween(start, end int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	err := r.db.
+		Where("internal = ? AND date >= ? AND date <= ?", false, time.UnixMilli(start), time.UnixMilli(end)).
+		Order("date").
+		Find(&transfers).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// GetUnlinkedTransfers returns transfers of the portfolio since start that
+// are not linked to another portfolio.
+func (r *repo) GetUnlinkedTransfers(portfolio *model.Portfolio, start int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	err := r.db.
+		Where("portfolio_id = ? AND internal = ? AND date >= ?", portfolio.ID, false, time.UnixMilli(start)).
+		Order("date").
+		Find(&transfers).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// GetUnvaluedTransfers returns transfers of the portfolio stored without a
+// model.QuoteAsset value, as their asset had no price.
+func (r *repo) GetUnvaluedTransfers(portfolio *model.Portfolio) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	err := r.db.
+		Where("portfolio_id = ? AND quote_amount IS NULL", portfolio.ID).
+		Order("date").
+		Find(&transfers).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// GetCounterTransfer returns the unlinked transfer of another portfolio
+// that moved the same amount of the asset the other way around the same
+// time, or nil if there is none.
+func (r *repo) GetCounterTransfer(transfer *model.Transfer) (*model.Transfer, error) {
+	var candidates []*model.Transfer
+	err := r.db.
+		Where("portfolio_id <> ? AND internal = ? AND asset = ? AND amount * ? < 0 AND date >= ? AND date <= ?",
+			transfer.PortfolioID, false, transfer.Asset, transfer.Amount,
+			transfer.Date.Add(-transferMatchWindow), transfer.Date.Add(transferMatchWindow)).
+		Find(&candidates).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var match *model.Transfer
+	for _, candidate := range candidates {
+		if math.Abs(candidate.Amount+transfer.Amount) > math.Abs(transfer.Amount)*transferMatchTolerance {
+			continue
+		}
+
+		if match == nil || absDuration(candidate.Date.Sub(transfer.Date)) < absDuration(match.Date.Sub(transfer.Date)) {
+			match = candidate
+		}
+	}
+
+	return match, nil
+}
+
+// GetNetDeposits returns the value in model.QuoteAsset of what flowed into
+// the portfolio between start and end, less what flowed out. Without a
+// portfolio it returns the net external flow into all portfolios, since
+// internal transfers cancel out.
+func (r *repo) GetNetDeposits(portfolio *model.Portfolio, start, end int64) (float64, error) {
+	query := r.db.Model(&model.Transfer{}).
+		Where("date >= ? AND date <= ?", time.UnixMilli(start), time.UnixMilli(end))
+
+	if portfolio != nil {
+		query = query.Where("portfolio_id = ?", portfolio.ID)
+	} else {
+		query = query.Where("internal = ?", false)
+	}
+
+	var total float64
+	if err := query.Select("COALESCE(SUM(quote_amount), 0)").Scan(&total).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
+
+func (r *repo) GetLatestCandle(exchange, symbol, interval string) (*model.Candle, error) {
+	candle := &model.Candle{}
+	err := r.db.
+		Where("exchange = ? AND symbol = ? AND interval = ?", exchange, symbol, interval).
+		Order("open_time DESC").
+		First(candle).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return candle, nil
+}
+
+func (r *repo) GetCandlesBetween(exchange, symbol, interval string, start, end int64) ([]*model.Candle, error) {
+	var candles []*model.Candle
+	err := r.db.
+		Where("exchange = ? AND symbol = ? AND interval = ? AND open_time >= ? AND open_time <= ?",
+			exchange, symbol, interval, time.UnixMilli(start), time.UnixMilli(end)).
+		Order("open_time").
+		Find(&candles).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return candles, nil
+}
+
+// GetFundingSymbols returns the symbols the portfolio holds positions in
+// or has paid funding on.
+func (r *repo) GetFundingSymbols(portfolio *model.Portfolio) ([]string, error) {
+	var positionSymbols []string
+	err := r.db.Model(&model.Position{}).
+		Where("portfolio_id = ?", portfolio.ID).
+		Distinct().
+		Pluck("symbol", &positionSymbols).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var incomeSymbols []string
+	err = r.db.Model(&model.Income{}).
+		Where("portfolio_id = ? AND type = ?", portfolio.ID, "FUNDING_FEE").
+		Distinct().
+		Pluck("symbol", &incomeSymbols).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return uniqueStrings(positionSymbols, incomeSymbols), nil
+}
+
+func (r *repo) GetEarliestFundingIncome(portfolio *model.Portfolio, symbol string) (*model.Income, error) {
+	income := &model.Income{}
+	err := r.db.
+		Where("portfolio_id = ? AND symbol = ? AND type = ?", portfolio.ID, symbol, "FUNDING_FEE").
+		Order("date").
+		First(income).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return income, nil
+}
+
+func (r *repo) GetLatestFundingRate(exchange, symbol string) (*model.FundingRate, error) {
+	rate := &model.FundingRate{}
+	err := r.db.
+		Where("exchange = ? AND symbol = ?", exchange, symbol).
+		Order("date DESC").
+		First(rate).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return rate, nil
+}
+
+// GetFundingRateAt returns the last funding rate of the symbol published
+// for a funding time no later than at.
+func (r *repo) GetFundingRateAt(exchange, symbol string, at int64) (*model.FundingRate, error) {
+	rate := &model.FundingRate{}
+	err := r.db.
+		Where("exchange = ? AND symbol = ? AND date <= ?", exchange, symbol, time.UnixMilli(at)).
+		Order("date DESC").
+		First(rate).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return rate, nil
+}
+
+func (r *repo) GetSymbolInfo(exchange, symbol string) (*model.SymbolInfo, error) {
+	info := &model.SymbolInfo{}
+	err := r.db.Where("exchange = ? AND symbol = ?", exchange, symbol).First(info).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (r *repo) GetSymbolInfos(exchange string) ([]*model.SymbolInfo, error) {
+	var infos []*model.SymbolInfo
+	if err := r.db.Where("exchange = ?", exchange).Order("symbol").Find(&infos).Error; err != nil {
+		return nil, err
+	}
+
+	return infos, nil
+}
+
+// GetDelistingPositions returns the open positions of all portfolios in
+// symbols their exchange is delisting or has delisted.
+func (r *repo) GetDelistingPositions() ([]*model.Position, error) {
+	var positions []*model.Position
+	err := r.db.
+		Select("positions.*").
+		Joins("JOIN portfolios ON portfolios.id = positions.portfolio_id").
+		Joins("JOIN symbol_infos ON symbol_infos.exchange = portfolios.exchange AND symbol_infos.symbol = positions.symbol").
+		Where("symbol_infos.status IN ?", []string{model.SymbolStatusDelisting, model.SymbolStatusDelisted}).
+		Find(&positions).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+func (r *repo) GetLatestAccountSnapshot(portfolio *model.Portfolio) (*model.AccountSnapshot, error) {
+	snapshot := &model.AccountSnapshot{}
+	err := r.db.
+		Preload("Assets").
+		Where("portfolio_id = ?", portfolio.ID).
+		Order("scraped_at DESC").
+		First(snapshot).
+		Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func (r *repo) GetAccountSnapshotsBetween(portfolio *model.Portfolio, start, end int64) ([]*model.AccountSnapshot, error) {
+	var snapshots []*model.AccountSnapshot
+	err := r.db.
+		Preload("Assets").
+		Where("portfolio_id = ? AND scraped_at >= ? AND scraped_at <= ?", portfolio.ID, start, end).
+		Order("scraped_at").
+		Find(&snapshots).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// GetScrapeRunsBetween returns the runs started between start and end,
+// with the results of their tasks.
+func (r *repo) GetScrapeRunsBetween(start, end int64) ([]*model.ScrapeRun, error) {
+	var runs []*model.ScrapeRun
+	err := r.db.
+		Preload("Tasks").
+		Where("started_at >= ? AND started_at <= ?", time.UnixMilli(start), time.UnixMilli(end)).
+		Order("started_at").
+		Find(&runs).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+func (r *repo) GetLatestTaskResult(portfolio *model.Portfolio, task string) (*model.ScrapeTaskResult, error) {
+	return r.getLatestTaskResult(r.db.Where("portfolio_id = ? AND task = ?", portfolio.ID, task))
+}
+
+// GetLatestSuccessfulTaskResult returns the result of the last run of the
+// task that succeeded, which the portfolio's data is as fresh as.
+func (r *repo) GetLatestSuccessfulTaskResult(portfolio *model.Portfolio, task string) (*model.ScrapeTaskResult, error) {
+	return r.getLatestTaskResult(r.db.Where("portfolio_id = ? AND task = ? AND NOT skipped AND error = ''", portfolio.ID, task))
+}
+
+func (r *repo) getLatestTaskResult(query *gorm.DB) (*model.ScrapeTaskResult, error) {
+	result := &model.ScrapeTaskResult{}
+	if err := query.Order("started_at DESC").First(result).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *repo) GetPortfolioBreaker(portfolio *model.Portfolio) (*model.PortfolioBreaker, error) {
+	breaker := &model.PortfolioBreaker{}
+	if err := r.db.Where("portfolio_id = ?", portfolio.ID).First(breaker).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return breaker, nil
+}
+
+func (r *repo) GetPortfolioBreakers() ([]*model.PortfolioBreaker, error) {
+	var breakers []*model.PortfolioBreaker
+	if err := r.db.Order("portfolio_id").Find(&breakers).Error; err != nil {
+		return nil, err
+	}
+
+	return breakers, nil
+}
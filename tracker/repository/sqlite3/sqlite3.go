@@ -3,6 +3,7 @@ package sqlite3
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
 	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
@@ -34,19 +35,132 @@ func NewRepository(dialector gorm.Dialector) (repository.Repository, error) {
 		return nil, err
 	}
 
+	// sqlite does not handle concurrent writers, portfolios are scraped
+	// concurrently, so all queries are funneled through one connection.
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	// symbol prices were keyed by symbol alone, they only hold the latest
+	// prices, so the table is recreated rather than migrated
+	if db.Migrator().HasTable(&model.SymbolPrice{}) && !db.Migrator().HasColumn(&model.SymbolPrice{}, "exchange") {
+		if err := db.Migrator().DropTable(&model.SymbolPrice{}); err != nil {
+			return nil, err
+		}
+	}
+
 	db.AutoMigrate(
 		&model.Position{},
+		&model.PositionSnapshot{},
 		&model.Portfolio{},
 		&model.Order{},
 		&model.Income{},
+		&model.Trade{},
+		&model.HistoryCursor{},
+		&model.Transfer{},
 		&model.DailyBalance{},
 		&model.CurrentBalance{},
 		&model.SymbolPrice{},
+		&model.PriceSample{},
+		&model.Candle{},
+		&model.FundingRate{},
+		&model.SymbolInfo{},
+		&model.AccountSnapshot{},
+		&model.AssetBalance{},
+		&model.ScrapeRun{},
+		&model.ScrapeTaskResult{},
+		&model.PortfolioBreaker{},
 	)
 
+	if err := migrateQuoteValues(db); err != nil {
+		return nil, err
+	}
+
+	// order IDs were keyed without the symbol and portfolio, which sqlite
+	// cannot add to the key of an existing table
+	if err := migratePrimaryKey(db, &model.Order{}); err != nil {
+		return nil, err
+	}
+
 	return &repo{db}, nil
 }
 
+// migrateQuoteValues fills asset and quote columns of rows stored before
+// they existed, when every balance was a QuoteAsset balance.
+func migrateQuoteValues(db *gorm.DB) error {
+	quoteBalance := map[string]interface{}{
+		"asset":         model.QuoteAsset,
+		"asset_balance": gorm.Expr("balance"),
+	}
+
+	for _, balance := range []interface{}{&model.DailyBalance{}, &model.CurrentBalance{}} {
+		err := db.Model(balance).Where("asset IS NULL").Updates(quoteBalance).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Model(&model.Income{}).
+		Where("quote_income IS NULL AND asset = ?", model.QuoteAsset).
+		Update("quote_income", gorm.Expr("income")).
+		Error
+}
+
+// migratePrimaryKey recreates the table of the model when its primary key
+// differs from the one the model declares, and copies its rows over.
+func migratePrimaryKey(db *gorm.DB, value interface{}) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	table := stmt.Schema.Table
+
+	var columns []struct {
+		Name string
+		Pk   int
+	}
+	if err := db.Raw("PRAGMA table_info(" + table + ")").Scan(&columns).Error; err != nil {
+		return err
+	}
+
+	key := map[string]bool{}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+		if column.Pk > 0 {
+			key[column.Name] = true
+		}
+	}
+
+	migrated := len(key) == len(stmt.Schema.PrimaryFieldDBNames)
+	for _, name := range stmt.Schema.PrimaryFieldDBNames {
+		migrated = migrated && key[name]
+	}
+	if len(columns) == 0 || migrated {
+		return nil
+	}
+
+	old := table + "_old"
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().RenameTable(table, old); err != nil {
+			return err
+		}
+
+		if err := tx.Migrator().CreateTable(value); err != nil {
+			return err
+		}
+
+		list := strings.Join(names, ", ")
+		if err := tx.Exec("INSERT INTO " + table + " (" + list + ") SELECT " + list + " FROM " + old).Error; err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropTable(old)
+	})
+}
+
 func (r *repo) limitedDB() *gorm.DB {
 	return r.db.Limit(100)
 }
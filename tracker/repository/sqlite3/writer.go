@@ -6,10 +6,69 @@ import (
 
 	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func (r *repo) CreateSymbolPrice(sp *model.SymbolPrice) error {
-	return r.createOrUpdate(sp, "symbol = ?", sp.Symbol)
+// upsertBatchSize keeps batched upserts under the sqlite limit on query
+// variables.
+const upsertBatchSize = 100
+
+func (r *repo) CreateSymbolPrices(prices []*model.SymbolPrice) error {
+	if len(prices) == 0 {
+		return nil
+	}
+
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(prices, upsertBatchSize).Error
+}
+
+func (r *repo) CreatePriceSamples(samples []*model.PriceSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(samples, upsertBatchSize).Error
+}
+
+func (r *repo) CreateCandles(candles []*model.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(candles, upsertBatchSize).Error
+}
+
+func (r *repo) CreateFundingRates(rates []*model.FundingRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rates, upsertBatchSize).Error
+}
+
+// UpdateSymbolInfos replaces the symbol catalog of the exchange. Symbols
+// the exchange no longer lists are kept, as delisted.
+func (r *repo) UpdateSymbolInfos(exchange string, infos []*model.SymbolInfo) error {
+	// an empty listing is more likely a bad response than a delisting of
+	// every symbol
+	if len(infos) == 0 {
+		return nil
+	}
+
+	symbols := make([]string, 0, len(infos))
+	for _, info := range infos {
+		symbols = append(symbols, info.Symbol)
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(infos, upsertBatchSize).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&model.SymbolInfo{}).
+			Where("exchange = ? AND symbol NOT IN ?", exchange, symbols).
+			Update("status", model.SymbolStatusDelisted).Error
+	})
 }
 
 func (r *repo) SyncPortfolio(portfolio *model.Portfolio) error {
@@ -34,32 +93,112 @@ func (r *repo) CreatePosition(position *model.Position) error {
 	return r.createOrUpdate(position, "symbol = ? AND side = ? AND portfolio_id = ?", position.Symbol, position.Side, position.Portfolio.ID)
 }
 
-func (r *repo) CreateOrder(order *model.Order) error {
-	if err := r.db.Create(order).Error; err != nil {
-		return err
-	}
+func (r *repo) CreatePositionSnapshot(snapshot *model.PositionSnapshot) error {
+	return r.db.Create(snapshot).Error
+}
 
-	return nil
+// CreateAccountSnapshot creates the snapshot along with its assets.
+func (r *repo) CreateAccountSnapshot(snapshot *model.AccountSnapshot) error {
+	return r.db.Create(snapshot).Error
 }
 
-func (r *repo) RemoveAllPositions(portfolio *model.Portfolio) error {
-	return r.db.Where("portfolio_id = ?", portfolio.ID).Delete(model.Position{}).Error
+func (r *repo) CreateOrder(order *model.Order) error {
+	return r.createOrUpdate(order, "id = ? AND symbol = ? AND portfolio_id = ?", order.ID, order.Symbol, order.Portfolio.ID)
 }
 
-func (r *repo) RemoveAllOrders(portfolio *model.Portfolio) error {
-	return r.db.Where("portfolio_id = ?", portfolio.ID).Delete(&model.Order{}).Error
+// ReplacePosition replaces the portfolio's position in the symbol and side
+// with the position, or removes it if the position is closed.
+func (r *repo) ReplacePosition(position *model.Position) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Where("portfolio_id = ? AND symbol = ? AND side = ?", position.PortfolioID, position.Symbol, position.Side).
+			Delete(model.Position{}).
+			Error
+		if err != nil || !position.IsOpen() {
+			return err
+		}
+
+		return tx.Create(position).Error
+	})
+}
+
+// ReplacePositions replaces all positions of the portfolio in a single
+// transaction, so an interrupted scrape never leaves them half written.
+func (r *repo) ReplacePositions(portfolio *model.Portfolio, positions []*model.Position) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("portfolio_id = ?", portfolio.ID).Delete(model.Position{}).Error; err != nil {
+			return err
+		}
+
+		for _, position := range positions {
+			if err := tx.Create(position).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 func (r *repo) CreateIncome(income *model.Income) error {
 	return r.createOrUpdate(income, "id = ? AND portfolio_id = ? AND type = ?", income.ID, income.Portfolio.ID, income.Type)
 }
 
+func (r *repo) CreateTrade(trade *model.Trade) error {
+	return r.createOrUpdate(trade, "id = ? AND symbol = ? AND portfolio_id = ?", trade.ID, trade.Symbol, trade.Portfolio.ID)
+}
+
+func (r *repo) SaveHistoryCursor(cursor *model.HistoryCursor) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(cursor).Error
+}
+
+func (r *repo) CreateTransfer(transfer *model.Transfer) error {
+	return r.createOrUpdate(transfer, "external_id = ? AND type = ? AND portfolio_id = ?", transfer.ExternalID, transfer.Type, transfer.Portfolio.ID)
+}
+
+// LinkTransfers marks both transfers internal, each pointing at the
+// portfolio of the other.
+func (r *repo) LinkTransfers(transfer, counter *model.Transfer) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(transfer).Updates(map[string]interface{}{
+			"internal":        true,
+			"counterparty_id": counter.PortfolioID,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(counter).Updates(map[string]interface{}{
+			"internal":        true,
+			"counterparty_id": transfer.PortfolioID,
+		}).Error
+	})
+}
+
 func (r *repo) CreateDailyBalance(balance *model.DailyBalance) error {
-	return r.createOrUpdate(balance, "date = ? AND portfolio_id = ?", balance.Date, balance.Portfolio.ID)
+	return r.createOrReplace(balance, "date = ? AND portfolio_id = ? AND asset = ?", balance.Date, balance.Portfolio.ID, balance.Asset)
 }
 
 func (r *repo) UpdateCurrentBalance(balance *model.CurrentBalance) error {
-	return r.createOrUpdate(balance, "portfolio_id = ?", balance.Portfolio.ID)
+	return r.createOrReplace(balance, "portfolio_id = ? AND asset = ?", balance.Portfolio.ID, balance.Asset)
+}
+
+func (r *repo) CreateScrapeRun(run *model.ScrapeRun) error {
+	return r.db.Omit("Tasks").Create(run).Error
+}
+
+func (r *repo) UpdateScrapeRun(run *model.ScrapeRun) error {
+	return r.db.Omit("Tasks").Save(run).Error
+}
+
+func (r *repo) CreateScrapeTaskResult(result *model.ScrapeTaskResult) error {
+	return r.db.Create(result).Error
+}
+
+// SavePortfolioBreaker stores the breaker with all of its fields, so a
+// closed breaker resets its failures.
+func (r *repo) SavePortfolioBreaker(breaker *model.PortfolioBreaker) error {
+	return r.db.Save(breaker).Error
 }
 
 func (r *repo) createOrUpdate(model interface{}, query string, args ...interface{}) error {
@@ -74,3 +213,19 @@ func (r *repo) createOrUpdate(model interface{}, query string, args ...interface
 
 	return r.db.Model(dummy).Updates(model).Error
 }
+
+// createOrReplace is createOrUpdate for records whose fields may go back to
+// zero, such as drained balances. Every field of the stored record is
+// replaced, where createOrUpdate skips zero values.
+func (r *repo) createOrReplace(model interface{}, query string, args ...interface{}) error {
+	mt := reflect.TypeOf(model)
+	dummy := reflect.New(mt).Interface()
+	if err := r.db.Where(query, args...).First(dummy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return r.db.Create(model).Error
+		}
+		return err
+	}
+
+	return r.db.Model(dummy).Select("*").Omit("id", clause.Associations).Updates(model).Error
+}
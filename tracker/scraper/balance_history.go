@@ -0,0 +1,176 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/valuation"
+)
+
+const oneDay = 24 * time.Hour
+
+// DeriveBalanceHistory rebuilds the daily balances of the days before the
+// portfolio was first scraped, by walking income and transfers backwards
+// from today's balance. It runs once, after the income history is scraped
+// and a balance was observed today.
+//
+// Balances observed by the scraper are kept, and the walk continues from
+// them. Only assets with a balance observed today are walked, as flows in
+// assets the exchange reports no balance of, such as commission paid in
+// BNB, cannot be told apart from a balance of 0. Derived balances are
+// valued in model.QuoteAsset at the prices of their day, or current prices
+// where price history does not reach back, and are off before the oldest
+// transfer the exchange still reports.
+func (s *portfolioScraper) DeriveBalanceHistory(ctx context.Context) error {
+	portfolio := s.ctx.Portfolio
+	if !config.ScrapeHistory || !portfolio.HistoryScraped || portfolio.BalancesDerived {
+		return nil
+	}
+
+	s.logf("deriving balance history")
+
+	earliest, err := s.repo.GetEarliestIncome(portfolio)
+	if err != nil {
+		return err
+	}
+
+	if earliest != nil {
+		derived, err := s.deriveBalancesSince(earliest.Date)
+		if err != nil || !derived {
+			return err
+		}
+	}
+
+	portfolio.BalancesDerived = true
+	return s.repo.UpdatePortfolio(portfolio)
+}
+
+// deriveBalancesSince derives the daily balances since the given time. It
+// reports false, having derived none, when no balance was observed today
+// to walk back from.
+func (s *portfolioScraper) deriveBalancesSince(since time.Time) (bool, error) {
+	now := time.Now()
+	today := now.UTC().Truncate(oneDay)
+	start := since.UTC().Truncate(oneDay)
+
+	observed, err := s.repo.GetDailyBalancesBetween(s.ctx.Portfolio, start.Add(-oneDay).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+
+	observedByDay := map[time.Time]map[string]float64{}
+	for _, balance := range observed {
+		if balance.Derived {
+			continue
+		}
+
+		date := balance.Date.UTC().Truncate(oneDay)
+		if observedByDay[date] == nil {
+			observedByDay[date] = map[string]float64{}
+		}
+		observedByDay[date][balance.Asset] = balance.AssetBalance
+	}
+
+	if len(observedByDay[today]) == 0 {
+		s.logf("no balance observed today, deriving balance history later")
+		return false, nil
+	}
+
+	flows, err := s.dailyFlows(start, now)
+	if err != nil {
+		return false, err
+	}
+
+	balances := map[string]float64{}
+	for asset, balance := range observedByDay[today] {
+		balances[asset] = balance
+	}
+
+	// the balance at the end of a day is the balance at the end of the
+	// next one, less what flowed in during the next one
+	for date := today; !date.Before(start); date = date.Add(-oneDay) {
+		for asset, amount := range flows[date] {
+			if _, ok := balances[asset]; ok {
+				balances[asset] -= amount
+			}
+		}
+
+		previous := date.Add(-oneDay)
+		for asset, balance := range balances {
+			if observedBalance, ok := observedByDay[previous][asset]; ok {
+				balances[asset] = observedBalance
+				continue
+			}
+
+			if math.Abs(balance) < 1e-9 {
+				continue
+			}
+
+			if err := s.saveDerivedBalance(previous, asset, balance); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// dailyFlows sums income and transfers of every asset by day. Income of
+// type TRANSFER is left out, as it is recorded as a transfer too.
+func (s *portfolioScraper) dailyFlows(start, end time.Time) (map[time.Time]map[string]float64, error) {
+	flows := map[time.Time]map[string]float64{}
+	add := func(date time.Time, asset string, amount float64) {
+		date = date.UTC().Truncate(oneDay)
+		if flows[date] == nil {
+			flows[date] = map[string]float64{}
+		}
+		flows[date][asset] += amount
+	}
+
+	incomes, err := s.repo.GetPortfolioIncomeBetween(s.ctx.Portfolio, start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, income := range incomes {
+		if income.Type != "TRANSFER" {
+			add(income.Date, income.Asset, income.Income)
+		}
+	}
+
+	transfers, err := s.repo.GetTransfersBetween(s.ctx.Portfolio, start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, transfer := range transfers {
+		add(transfer.Date, transfer.Asset, transfer.Amount)
+	}
+
+	return flows, nil
+}
+
+func (s *portfolioScraper) saveDerivedBalance(date time.Time, asset string, assetBalance float64) error {
+	balance, err := s.toQuoteAt(asset, assetBalance, date.Add(oneDay))
+	if errors.As(err, new(*valuation.NoPriceError)) {
+		balance, err = s.toQuote(asset, assetBalance)
+	}
+	if err != nil {
+		return err
+	}
+
+	dailyBalance := &model.DailyBalance{
+		Asset:        asset,
+		AssetBalance: assetBalance,
+		Balance:      balance,
+		Derived:      true,
+		Date:         date,
+	}
+
+	dailyBalance.ScrapeCtx.Apply(s.ctx)
+	return s.repo.CreateDailyBalance(dailyBalance)
+}
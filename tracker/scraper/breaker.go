@@ -0,0 +1,121 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper/exchange"
+)
+
+// scrapeWithBreaker scrapes the named tasks of the portfolio unless its
+// circuit breaker is open, and records the outcome in the breaker. Scrapes
+// cut short by ctx are not recorded, as they say nothing about the account,
+// and neither are task failures that are not the account's, see
+// breakerError.
+func (s *scraper) scrapeWithBreaker(ctx context.Context, j *journal, portfolio *model.Portfolio, tasks ...string) error {
+	breaker, err := s.getBreaker(portfolio)
+	if err != nil {
+		return err
+	}
+
+	if retryAt, ok := s.allowBreaker(portfolio, breaker); !ok {
+		reason := fmt.Sprintf("circuit breaker open until %s", retryAt.Format(time.RFC3339))
+		log.Printf("[%s] skipped, %s", portfolio.ID, reason)
+		j.skip(s.newScrapeCtx(portfolio), "connect", reason)
+		return nil
+	}
+
+	err = s.scrapePortfolio(ctx, j, portfolio, tasks...)
+	if ctx.Err() != nil {
+		return err
+	}
+
+	s.recordBreaker(portfolio, breaker, breakerError(err))
+	return err
+}
+
+// breakerError returns the failure of a scrape the breaker counts: failing
+// to connect, or a task failing because the API key was refused or the
+// exchange could not be reached. Other task failures, such as missing
+// prices or symbols, are left to the task's own retries and return nil.
+func breakerError(err error) error {
+	var failures *taskErrors
+	if !errors.As(err, &failures) {
+		return err
+	}
+
+	for _, err := range failures.errs {
+		if exchange.IsAuthFailure(err) || exchange.IsTransient(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// allowBreaker reports whether the breaker lets the portfolio be scraped,
+// and until when it is open if not. Scrapes and the user data stream of a
+// portfolio share its breaker, so it is only used under the lock.
+func (s *scraper) allowBreaker(portfolio *model.Portfolio, breaker *model.PortfolioBreaker) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := breaker.State
+	if !breaker.Allow(time.Now()) {
+		return breaker.RetryAt, false
+	}
+
+	if breaker.State != state {
+		log.Printf("[%s] circuit breaker half-open, trying to scrape again", portfolio.ID)
+	}
+
+	return time.Time{}, true
+}
+
+// recordBreaker records the outcome of a scrape in the breaker and saves it.
+func (s *scraper) recordBreaker(portfolio *model.Portfolio, breaker *model.PortfolioBreaker, err error) {
+	s.mu.Lock()
+	if breaker.Record(err, config.BreakerThreshold, config.BreakerCooldown, time.Now()) {
+		switch breaker.State {
+		case model.BreakerOpen:
+			log.Printf("[%s] circuit breaker opened after %d failed scrapes, paused until %s", portfolio.ID, breaker.Failures, breaker.RetryAt.Format(time.RFC3339))
+		case model.BreakerClosed:
+			log.Printf("[%s] circuit breaker closed", portfolio.ID)
+		}
+	}
+	saved := *breaker
+	s.mu.Unlock()
+
+	if err := s.repo.SavePortfolioBreaker(&saved); err != nil {
+		log.Print(fmt.Errorf("failed to save circuit breaker of portfolio %s: %v", portfolio.ID, err))
+	}
+}
+
+// getBreaker returns the circuit breaker of the portfolio, loading it from
+// the repository the first time, so pauses outlast restarts.
+func (s *scraper) getBreaker(portfolio *model.Portfolio) (*model.PortfolioBreaker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	breaker, ok := s.breakers[portfolio.ID]
+	if ok {
+		return breaker, nil
+	}
+
+	breaker, err := s.repo.GetPortfolioBreaker(portfolio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load circuit breaker: %v", err)
+	}
+
+	if breaker == nil {
+		breaker = model.NewPortfolioBreaker(portfolio.ID)
+	}
+
+	s.breakers[portfolio.ID] = breaker
+	return breaker, nil
+}
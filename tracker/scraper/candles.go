@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+// ScrapeCandles brings candles of every symbol the portfolio has traded up
+// to date, at every configured interval. Candles continue from the latest
+// stored one, so the time the scraper was down is filled in, and start
+// config.CandleHistory back for symbols without any.
+func (s *portfolioScraper) ScrapeCandles(ctx context.Context) error {
+	if len(config.CandleIntervals) == 0 {
+		return nil
+	}
+
+	s.logf("scraping candles")
+
+	symbols, err := s.repo.GetTradedSymbols(s.ctx.Portfolio)
+	if err != nil {
+		return err
+	}
+
+	for _, interval := range config.CandleIntervals {
+		for _, symbol := range symbols {
+			// symbols may have been delisted since they were traded
+			if err := s.scrapeSymbolCandles(ctx, symbol, interval); err != nil {
+				s.logf("failed to scrape %s candles of %s: %v", interval, symbol, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *portfolioScraper) scrapeSymbolCandles(ctx context.Context, symbol, interval string) error {
+	exchange := s.ctx.Portfolio.Exchange
+	now := time.Now().UnixMilli()
+
+	start := time.Now().Add(-config.CandleHistory).UnixMilli()
+	latest, err := s.repo.GetLatestCandle(exchange, symbol, interval)
+	if err != nil {
+		return err
+	}
+
+	// the latest candle may have been open when it was stored
+	if latest != nil {
+		start = latest.OpenTime.UnixMilli()
+	}
+
+	for start <= now {
+		candles, err := s.candles.GetCandles(ctx, symbol, interval, start, now)
+		if err != nil {
+			return err
+		}
+
+		if len(candles) == 0 {
+			return nil
+		}
+
+		for _, candle := range candles {
+			candle.Exchange = exchange
+		}
+
+		if err := s.repo.CreateCandles(candles); err != nil {
+			return err
+		}
+
+		next := candles[len(candles)-1].OpenTime.Add(model.CandleIntervals[interval]).UnixMilli()
+		if next <= start {
+			return nil
+		}
+		start = next
+	}
+
+	return nil
+}
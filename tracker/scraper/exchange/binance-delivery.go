@@ -0,0 +1,592 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/delivery"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+// binanceDelivery is the binance COIN-M futures exchange. Its balances and
+// income are denominated in the margin asset of each contract.
+type binanceDelivery struct {
+	portfolio *model.Portfolio
+	client    *delivery.Client
+	ctx       *model.ScrapeCtx
+}
+
+var binanceDeliveryWeights = map[string][2]int32{
+	"/dapi/v1/ping":            {1, 1},
+	"/dapi/v1/time":            {1, 1},
+	"/dapi/v1/ticker/price":    {1, 2},
+	"/dapi/v1/exchangeInfo":    {1, 1},
+	"/dapi/v1/klines":          {5, 5},
+	"/dapi/v1/markPriceKlines": {5, 5},
+	"/dapi/v1/account":         {5, 5},
+	"/dapi/v1/openOrders":      {1, 40},
+	"/dapi/v1/order":           {1, 1},
+	"/dapi/v1/allOrders":       {20, 40},
+	"/dapi/v1/income":          {20, 20},
+	"/dapi/v1/userTrades":      {20, 40},
+}
+
+const (
+	// binanceDeliveryHistoryWindow is the longest time range userTrades
+	// and allOrders accept.
+	binanceDeliveryHistoryWindow = 7 * 24 * time.Hour
+	// binanceDeliveryOrderRetention is how far back allOrders can be queried.
+	binanceDeliveryOrderRetention = 90 * 24 * time.Hour
+	// binanceDeliveryKlineWindow is the longest time range klines accept.
+	binanceDeliveryKlineWindow = 200 * 24 * time.Hour
+
+	// binanceDeliveryWeightLimit is the request weight used per minute, half
+	// of the 2400 binance allows, as other clients may share the key.
+	binanceDeliveryWeightLimit = 1200
+)
+
+func init() {
+	Register(Definition{
+		Name:        "binance-delivery",
+		Description: "Binance COIN-M futures",
+		New:         NewBinanceDelivery,
+		WeightLimit: binanceDeliveryWeightLimit,
+		Capabilities: []Capability{
+			CapabilityPrices,
+			CapabilityBalance,
+			CapabilityAccount,
+			CapabilityPositions,
+			CapabilityOrders,
+			CapabilityIncome,
+			CapabilityTrades,
+			CapabilityTransfers,
+			CapabilityCandles,
+			CapabilitySymbols,
+			CapabilityFunding,
+		},
+	})
+}
+
+func NewBinanceDelivery(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx) (Exchange, error) {
+	client := delivery.NewClient(portfolio.APIKey, portfolio.APISecret)
+	client.HTTPClient = &http.Client{Transport: &binanceTransport{
+		weights:             binanceDeliveryWeights,
+		ctx:                 scrapeCtx,
+		UnderlyingTransport: http.DefaultTransport,
+	}}
+
+	err := client.NewPingService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping binance api: %v", err)
+	}
+
+	exchange := &binanceDelivery{
+		portfolio: portfolio,
+		client:    client,
+		ctx:       scrapeCtx,
+	}
+
+	return exchange, nil
+}
+
+func (e *binanceDelivery) GetSymbolPrices(ctx context.Context) ([]*model.SymbolPrice, error) {
+	prices, err := e.client.NewListPricesService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*model.SymbolPrice
+	for _, price := range prices {
+		p, err := strconv.ParseFloat(price.Price, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &model.SymbolPrice{Symbol: price.Symbol, Price: p})
+	}
+
+	return result, nil
+}
+
+func (e *binanceDelivery) GetBalance(ctx context.Context) (map[string]float64, error) {
+	account, err := e.client.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := map[string]float64{}
+	for _, asset := range account.Assets {
+		balance, err := strconv.ParseFloat(asset.WalletBalance, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if balance != 0 {
+			balances[asset.Asset] = balance
+		}
+	}
+
+	return balances, nil
+}
+
+// GetAccount returns the margin state of the account. Every asset is
+// margined on its own, so there are no account figures.
+func (e *binanceDelivery) GetAccount(ctx context.Context) (*model.AccountSnapshot, error) {
+	var account struct {
+		Assets []*binanceAccountAsset `json:"assets"`
+	}
+
+	if err := e.signedGet(ctx, "/dapi/v1/account", url.Values{}, &account); err != nil {
+		return nil, fmt.Errorf("failed to get account: %v", err)
+	}
+
+	assets, err := binanceAssetBalances(account.Assets)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AccountSnapshot{Assets: assets}, nil
+}
+
+func (e *binanceDelivery) GetPositions(ctx context.Context) ([]*model.Position, error) {
+	account, err := e.client.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %v", err)
+	}
+
+	var positions []*model.Position
+	for _, rawPosition := range account.Positions {
+		position, err := e.parsePosition(rawPosition)
+		if err != nil {
+			return nil, err
+		}
+
+		if position.IsOpen() {
+			positions = append(positions, position)
+		}
+	}
+
+	return positions, nil
+}
+
+func (e *binanceDelivery) GetOrders(ctx context.Context) ([]*model.Order, error) {
+	rawOrders, err := e.client.NewListOpenOrdersService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*model.Order
+	for _, rawOrder := range rawOrders {
+		order, err := e.parseOrder(rawOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+func (e *binanceDelivery) GetOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
+	rawOrder, err := e.client.NewGetOrderService().
+		Symbol(order.Symbol).
+		OrderID(order.ID).
+		Do(ctx)
+	if err != nil {
+		if apiErr, ok := err.(*common.APIError); ok && apiErr.Code == binanceOrderNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e.parseOrder(rawOrder)
+}
+
+func (e *binanceDelivery) GetOrdersBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Order, error) {
+	if oldest := time.Now().Add(-binanceDeliveryOrderRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	var orders []*model.Order
+	err := binancePaginate(startTime, endTime, binanceDeliveryHistoryWindow, func(start, end int64) (int, int64, error) {
+		rawOrders, err := e.client.NewListOrdersService().
+			Symbol(symbol).
+			StartTime(start).
+			EndTime(end).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil || len(rawOrders) == 0 {
+			return 0, 0, err
+		}
+
+		for _, rawOrder := range rawOrders {
+			order, err := e.parseOrder(rawOrder)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			orders = append(orders, order)
+		}
+
+		return len(rawOrders), rawOrders[len(rawOrders)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (e *binanceDelivery) GetIncome(ctx context.Context) ([]*model.Income, error) {
+	return e.GetIncomeBetween(ctx, 0, 0)
+}
+
+func (e *binanceDelivery) GetIncomeBetween(ctx context.Context, startTime, endTime int64) ([]*model.Income, error) {
+	params := url.Values{"limit": {"1000"}}
+	if startTime > 0 {
+		params.Set("startTime", strconv.FormatInt(startTime, 10))
+	}
+
+	if endTime > 0 {
+		params.Set("endTime", strconv.FormatInt(endTime, 10))
+	}
+
+	var rawIncomes []*futures.IncomeHistory
+	if err := e.signedGet(ctx, "/dapi/v1/income", params, &rawIncomes); err != nil {
+		return nil, err
+	}
+
+	var incomes []*model.Income
+	for _, rawIncome := range rawIncomes {
+		income, err := parseBinanceIncome(rawIncome)
+		if err != nil {
+			return nil, err
+		}
+
+		incomes = append(incomes, income)
+	}
+
+	return incomes, nil
+}
+
+// GetTransfersBetween returns transfers between the coin-m wallet and
+// the other wallets of the account.
+func (e *binanceDelivery) GetTransfersBetween(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	err := binancePaginate(binanceTransferStart(startTime), endTime, binanceTransferWindow, func(start, end int64) (int, int64, error) {
+		params := url.Values{
+			"incomeType": {"TRANSFER"},
+			"startTime":  {strconv.FormatInt(start, 10)},
+			"endTime":    {strconv.FormatInt(end, 10)},
+			"limit":      {strconv.Itoa(binanceHistoryLimit)},
+		}
+
+		var rawIncomes []*futures.IncomeHistory
+		if err := e.signedGet(ctx, "/dapi/v1/income", params, &rawIncomes); err != nil || len(rawIncomes) == 0 {
+			return 0, 0, err
+		}
+
+		for _, rawIncome := range rawIncomes {
+			transfer, err := parseBinanceIncomeTransfer(rawIncome)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			transfers = append(transfers, transfer)
+		}
+
+		return len(rawIncomes), rawIncomes[len(rawIncomes)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+type binanceDeliveryTrade struct {
+	ID              int64  `json:"id"`
+	Symbol          string `json:"symbol"`
+	OrderID         int64  `json:"orderId"`
+	Side            string `json:"side"`
+	PositionSide    string `json:"positionSide"`
+	Price           string `json:"price"`
+	Quantity        string `json:"qty"`
+	BaseQuantity    string `json:"baseQty"`
+	Commission      string `json:"commission"`
+	CommissionAsset string `json:"commissionAsset"`
+	RealizedPnl     string `json:"realizedPnl"`
+	Buyer           bool   `json:"buyer"`
+	Maker           bool   `json:"maker"`
+	Time            int64  `json:"time"`
+}
+
+func (e *binanceDelivery) GetTrades(ctx context.Context, symbol string) ([]*model.Trade, error) {
+	params := url.Values{
+		"symbol": {symbol},
+		"limit":  {strconv.Itoa(binanceHistoryLimit)},
+	}
+
+	var rawTrades []*binanceDeliveryTrade
+	if err := e.signedGet(ctx, "/dapi/v1/userTrades", params, &rawTrades); err != nil {
+		return nil, err
+	}
+
+	return e.parseTrades(rawTrades)
+}
+
+func (e *binanceDelivery) GetTradesBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Trade, error) {
+	var trades []*model.Trade
+	err := binancePaginate(startTime, endTime, binanceDeliveryHistoryWindow, func(start, end int64) (int, int64, error) {
+		params := url.Values{
+			"symbol":    {symbol},
+			"startTime": {strconv.FormatInt(start, 10)},
+			"endTime":   {strconv.FormatInt(end, 10)},
+			"limit":     {strconv.Itoa(binanceHistoryLimit)},
+		}
+
+		var rawTrades []*binanceDeliveryTrade
+		if err := e.signedGet(ctx, "/dapi/v1/userTrades", params, &rawTrades); err != nil || len(rawTrades) == 0 {
+			return 0, 0, err
+		}
+
+		page, err := e.parseTrades(rawTrades)
+		if err != nil {
+			return 0, 0, err
+		}
+		trades = append(trades, page...)
+
+		return len(rawTrades), rawTrades[len(rawTrades)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+// GetCandles returns klines from the first window of
+// binanceDeliveryKlineWindow that has any. Volume is in the base asset,
+// coin-m klines have no quote volume.
+func (e *binanceDelivery) GetCandles(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]*model.Candle, error) {
+	for startTime <= endTime {
+		windowEnd := startTime + binanceDeliveryKlineWindow.Milliseconds() - 1
+		if windowEnd > endTime {
+			windowEnd = endTime
+		}
+
+		klines, err := e.client.NewKlinesService().
+			Symbol(symbol).
+			Interval(interval).
+			StartTime(startTime).
+			EndTime(windowEnd).
+			Limit(binanceKlineLimit).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(klines) == 0 {
+			startTime = windowEnd + 1
+			continue
+		}
+
+		var candles []*model.Candle
+		for _, kline := range klines {
+			candle, err := parseBinanceKline(symbol, interval, (*binance.Kline)(kline))
+			if err != nil {
+				return nil, err
+			}
+
+			// coin-m volume is counted in contracts, the base asset
+			// volume is what the client decodes as quote volume
+			candle.Volume, candle.QuoteVolume = candle.QuoteVolume, 0
+			candles = append(candles, candle)
+		}
+
+		return candles, nil
+	}
+
+	return nil, nil
+}
+
+func (e *binanceDelivery) GetFundingRates(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.FundingRate, error) {
+	return binanceFundingRates(ctx, e.client.HTTPClient, e.client.BaseURL, "/dapi/v1", symbol, startTime, endTime)
+}
+
+// GetSymbolInfos returns the contracts of coin-m futures, whose lot size
+// is counted in contracts.
+func (e *binanceDelivery) GetSymbolInfos(ctx context.Context) ([]*model.SymbolInfo, error) {
+	exchangeInfo, err := e.client.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []*model.SymbolInfo
+	for _, symbol := range exchangeInfo.Symbols {
+		info, err := parseBinanceContract(symbol.Symbol, symbol.ContractType, symbol.ContractStatus,
+			symbol.OnboardDate, symbol.DeliveryDate, symbol.Filters)
+		if err != nil {
+			return nil, err
+		}
+
+		info.BaseAsset = symbol.BaseAsset
+		info.QuoteAsset = symbol.QuoteAsset
+		info.MarginAsset = symbol.MarginAsset
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (e *binanceDelivery) signedGet(ctx context.Context, endpoint string, params url.Values, result interface{}) error {
+	return binanceSignedGet(ctx, e.client.HTTPClient, e.client.BaseURL, endpoint, e.portfolio, params, result)
+}
+
+func (e *binanceDelivery) parsePosition(ap *delivery.AccountPosition) (*model.Position, error) {
+	amount, err := strconv.ParseFloat(ap.PositionAmt, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	cost, err := strconv.ParseFloat(ap.PositionInitialMargin, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	ePrice, err := strconv.ParseFloat(ap.EntryPrice, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	unpnl, err := strconv.ParseFloat(ap.UnrealizedProfit, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	lev, err := strconv.ParseInt(ap.Leverage, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Position{
+		Symbol:     ap.Symbol,
+		Amount:     amount,
+		Cost:       cost,
+		EntryPrice: ePrice,
+		Isolated:   ap.Isolated,
+		UnPnl:      unpnl,
+		Side:       ap.PositionSide,
+		Leverage:   int32(lev),
+		Date:       time.Now(),
+	}, nil
+}
+
+func (e *binanceDelivery) parseOrder(order *delivery.Order) (*model.Order, error) {
+	price, err := strconv.ParseFloat(order.Price, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := strconv.ParseFloat(order.OrigQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	executed, err := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var avgPrice float64
+	if order.AvgPrice != "" {
+		avgPrice, err = strconv.ParseFloat(order.AvgPrice, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &model.Order{
+		ID:             order.OrderID,
+		Symbol:         order.Symbol,
+		Side:           string(order.Side),
+		PositionSide:   string(order.PositionSide),
+		TimeInForce:    string(order.TimeInForce),
+		Type:           string(order.Type),
+		Status:         string(order.Status),
+		Price:          price,
+		AvgPrice:       avgPrice,
+		Amount:         amount,
+		ExecutedAmount: executed,
+		ReduceOnly:     order.ReduceOnly,
+		Date:           time.UnixMilli(order.Time),
+		UpdateDate:     time.UnixMilli(order.UpdateTime),
+	}, nil
+}
+
+func (e *binanceDelivery) parseTrades(rawTrades []*binanceDeliveryTrade) ([]*model.Trade, error) {
+	var trades []*model.Trade
+	for _, rawTrade := range rawTrades {
+		trade, err := e.parseTrade(rawTrade)
+		if err != nil {
+			return nil, err
+		}
+
+		trades = append(trades, trade)
+	}
+
+	return trades, nil
+}
+
+func (e *binanceDelivery) parseTrade(trade *binanceDeliveryTrade) (*model.Trade, error) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// coin-m trades are valued in the base asset
+	baseAmount, err := strconv.ParseFloat(trade.BaseQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	commission, err := strconv.ParseFloat(trade.Commission, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	pnl, err := strconv.ParseFloat(trade.RealizedPnl, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Trade{
+		ID:              trade.ID,
+		Symbol:          trade.Symbol,
+		OrderID:         trade.OrderID,
+		Side:            trade.Side,
+		PositionSide:    trade.PositionSide,
+		Price:           price,
+		Amount:          amount,
+		QuoteAmount:     baseAmount,
+		Commission:      commission,
+		CommissionAsset: trade.CommissionAsset,
+		RealizedPnl:     pnl,
+		Buyer:           trade.Buyer,
+		Maker:           trade.Maker,
+		Date:            time.UnixMilli(trade.Time),
+	}, nil
+}
@@ -0,0 +1,221 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/gorilla/websocket"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+// binanceListenKeyKeepalive is how often the listen key of a user data
+// stream is kept alive. Binance expires it after 60 minutes without.
+const binanceListenKeyKeepalive = 30 * time.Minute
+
+// StreamUserData streams account and order updates. It creates a listen key
+// for the stream, keeps it alive while connected, and closes it once done.
+func (e *binanceFutures) StreamUserData(ctx context.Context, connected func() error, handle func(*UserDataEvent) error) error {
+	listenKey, err := e.client.NewStartUserStreamService().Do(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create listen key: %v", err)
+	}
+
+	// an unclosed listen key expires on its own, so failing to close it is
+	// not an error
+	defer e.client.NewCloseUserStreamService().ListenKey(listenKey).Do(context.Background())
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, e.wsURL+"/"+listenKey, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// closing the connection stops the read loop, once ctx is done or the
+	// listen key could not be kept alive
+	done := make(chan struct{})
+	defer close(done)
+
+	keepaliveErr := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(binanceListenKeyKeepalive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := e.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx); err != nil {
+					keepaliveErr <- err
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	if err := connected(); err != nil {
+		return err
+	}
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case err := <-keepaliveErr:
+				return fmt.Errorf("failed to keep listen key alive: %v", err)
+			default:
+				return err
+			}
+		}
+
+		event, err := e.parseUserDataEvent(ctx, message)
+		if err != nil {
+			return err
+		}
+
+		if event == nil {
+			continue
+		}
+
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+// parseUserDataEvent parses account and order updates. Other events are
+// returned as nil. Account updates carry the wallet balance of each asset
+// on its own, so balances are read again like GetBalance does.
+func (e *binanceFutures) parseUserDataEvent(ctx context.Context, message []byte) (*UserDataEvent, error) {
+	raw := &futures.WsUserDataEvent{}
+	if err := json.Unmarshal(message, raw); err != nil {
+		return nil, err
+	}
+
+	event := &UserDataEvent{Date: time.UnixMilli(raw.Time)}
+	switch raw.Event {
+	case futures.UserDataEventTypeListenKeyExpired:
+		return nil, fmt.Errorf("listen key expired")
+
+	case futures.UserDataEventTypeAccountUpdate:
+		if len(raw.AccountUpdate.Balances) > 0 {
+			balances, err := e.GetBalance(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read balance: %v", err)
+			}
+
+			event.Balances = balances
+		}
+
+		for i := range raw.AccountUpdate.Positions {
+			position, err := e.parseWsPosition(&raw.AccountUpdate.Positions[i], raw.TransactionTime)
+			if err != nil {
+				return nil, err
+			}
+
+			event.Positions = append(event.Positions, position)
+		}
+
+	case futures.UserDataEventTypeOrderTradeUpdate:
+		order, err := e.parseWsOrder(&raw.OrderTradeUpdate)
+		if err != nil {
+			return nil, err
+		}
+
+		event.Order = order
+
+	default:
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// parseWsPosition parses a position of an account update, which carries
+// neither leverage nor margin. Streams send margin types in lower case.
+func (e *binanceFutures) parseWsPosition(wp *futures.WsPosition, updateTime int64) (*model.Position, error) {
+	amount, err := strconv.ParseFloat(wp.Amount, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	ePrice, err := strconv.ParseFloat(wp.EntryPrice, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	unpnl, err := strconv.ParseFloat(wp.UnrealizedPnL, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Position{
+		Symbol:     wp.Symbol,
+		Amount:     amount,
+		EntryPrice: ePrice,
+		Isolated:   strings.EqualFold(string(wp.MarginType), string(futures.MarginTypeIsolated)),
+		UnPnl:      unpnl,
+		Side:       string(wp.Side),
+		Date:       time.UnixMilli(updateTime),
+	}, nil
+}
+
+// parseWsOrder parses an order update. Only updates of new orders carry
+// the time the order was placed, Date is left unset otherwise.
+func (e *binanceFutures) parseWsOrder(wo *futures.WsOrderTradeUpdate) (*model.Order, error) {
+	price, err := strconv.ParseFloat(wo.OriginalPrice, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := strconv.ParseFloat(wo.OriginalQty, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	executed, err := strconv.ParseFloat(wo.AccumulatedFilledQty, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var avgPrice float64
+	if wo.AveragePrice != "" {
+		avgPrice, err = strconv.ParseFloat(wo.AveragePrice, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	order := &model.Order{
+		ID:             wo.ID,
+		Symbol:         wo.Symbol,
+		Side:           string(wo.Side),
+		PositionSide:   string(wo.PositionSide),
+		TimeInForce:    string(wo.TimeInForce),
+		Type:           string(wo.Type),
+		Status:         string(wo.Status),
+		Price:          price,
+		AvgPrice:       avgPrice,
+		Amount:         amount,
+		ExecutedAmount: executed,
+		ReduceOnly:     wo.IsReduceOnly,
+		UpdateDate:     time.UnixMilli(wo.TradeTime),
+	}
+
+	if wo.ExecutionType == futures.OrderExecutionTypeNew {
+		order.Date = order.UpdateDate
+	}
+
+	return order, nil
+}
@@ -0,0 +1,215 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+// fakeBinanceFutures serves the REST endpoints a user data stream uses,
+// and streams the scripted messages of each connection in turn.
+type fakeBinanceFutures struct {
+	t        *testing.T
+	messages [][]string
+
+	mu          sync.Mutex
+	listenKeys  []string
+	closedKeys  []string
+	connections []string
+}
+
+func (f *fakeBinanceFutures) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/fapi/v1/ping":
+		fmt.Fprint(w, `{}`)
+
+	case r.URL.Path == "/fapi/v1/account":
+		fmt.Fprint(w, `{"totalWalletBalance":"1500.25"}`)
+
+	case r.URL.Path == "/fapi/v1/listenKey":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		switch r.Method {
+		case http.MethodPost:
+			key := fmt.Sprintf("key-%d", len(f.listenKeys)+1)
+			f.listenKeys = append(f.listenKeys, key)
+			fmt.Fprintf(w, `{"listenKey":%q}`, key)
+		case http.MethodDelete:
+			// go-binance sends the key in the body, which ParseForm only
+			// reads for POST, PUT and PATCH
+			body, _ := io.ReadAll(r.Body)
+			values, _ := url.ParseQuery(string(body))
+			f.closedKeys = append(f.closedKeys, values.Get("listenKey"))
+			fmt.Fprint(w, `{}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+
+	case strings.HasPrefix(r.URL.Path, "/ws/"):
+		f.stream(w, r)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeBinanceFutures) stream(w http.ResponseWriter, r *http.Request) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+	if err != nil {
+		f.t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	f.connections = append(f.connections, strings.TrimPrefix(r.URL.Path, "/ws/"))
+	var messages []string
+	if n := len(f.connections); n <= len(f.messages) {
+		messages = f.messages[n-1]
+	}
+	f.mu.Unlock()
+
+	for _, message := range messages {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			return
+		}
+	}
+
+	// hold the connection open until the client closes it
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func newTestBinanceFutures(t *testing.T, messages ...[]string) (*binanceFutures, *fakeBinanceFutures) {
+	t.Helper()
+
+	fake := &fakeBinanceFutures{t: t, messages: messages}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	portfolio := &model.Portfolio{ID: "test", Exchange: "binance-futures", APIKey: "test-key", APISecret: "test-secret"}
+	scrapeCtx := &model.ScrapeCtx{Portfolio: portfolio, PortfolioID: portfolio.ID, Weight: NewWeightBudget(1000)}
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	e, err := newBinanceFutures(context.Background(), portfolio, scrapeCtx, server.URL, wsURL, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e, fake
+}
+
+const (
+	testAccountUpdate = `{"e":"ACCOUNT_UPDATE","E":1700000000100,"T":1700000000000,"a":{"m":"ORDER",` +
+		`"B":[{"a":"USDT","wb":"1000","cw":"1000","bc":"0"},{"a":"BNB","wb":"2","cw":"2","bc":"0"}],` +
+		`"P":[{"s":"BTCUSDT","ps":"LONG","pa":"0.5","mt":"isolated","ep":"30000","up":"12.5"}]}}`
+	testOrderUpdate = `{"e":"ORDER_TRADE_UPDATE","E":1700000000200,"T":1700000000200,"o":{"s":"BTCUSDT","S":"BUY",` +
+		`"o":"LIMIT","f":"GTC","q":"1","p":"30000","ap":"30000","x":"TRADE","X":"PARTIALLY_FILLED","i":42,` +
+		`"z":"0.5","T":1700000000200,"ps":"LONG","R":false}}`
+	testListenKeyExpired = `{"e":"listenKeyExpired","E":1700000000300}`
+)
+
+func TestBinanceFuturesUserDataStream(t *testing.T) {
+	e, fake := newTestBinanceFutures(t, []string{testAccountUpdate, testOrderUpdate, testListenKeyExpired})
+
+	connected := 0
+	var events []*UserDataEvent
+	err := e.StreamUserData(context.Background(), func() error {
+		connected++
+		return nil
+	}, func(event *UserDataEvent) error {
+		events = append(events, event)
+		return nil
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "listen key expired") {
+		t.Fatalf("error = %v, want the listen key to expire", err)
+	}
+	if connected != 1 {
+		t.Errorf("connected called %d times, want once", connected)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	account := events[0]
+	if len(account.Balances) != 1 || account.Balances[model.QuoteAsset] != 1500.25 {
+		t.Errorf("balances = %v, want the total wallet balance GetBalance reads", account.Balances)
+	}
+	if len(account.Positions) != 1 {
+		t.Fatalf("got %d positions, want 1", len(account.Positions))
+	}
+	if position := account.Positions[0]; position.Symbol != "BTCUSDT" || position.Amount != 0.5 || !position.Isolated || position.Side != "LONG" {
+		t.Errorf("position = %+v", position)
+	}
+
+	order := events[1].Order
+	if order == nil {
+		t.Fatal("order update has no order")
+	}
+	if order.ID != 42 || order.Status != "PARTIALLY_FILLED" || order.ExecutedAmount != 0.5 {
+		t.Errorf("order = %+v", order)
+	}
+	if !order.Date.IsZero() || order.UpdateDate.UnixMilli() != 1700000000200 {
+		t.Errorf("order dates = %v, %v, want only the update time", order.Date, order.UpdateDate)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fmt.Sprint(fake.closedKeys) != "[key-1]" {
+		t.Errorf("closed listen keys = %v, want key-1", fake.closedKeys)
+	}
+}
+
+func TestBinanceFuturesUserDataStreamReconnect(t *testing.T) {
+	e, fake := newTestBinanceFutures(t, []string{testListenKeyExpired}, []string{testOrderUpdate})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// reconnect the way the scraper does, resyncing on every connect
+	resyncs := 0
+	var streamErrs []error
+	for ctx.Err() == nil {
+		err := e.StreamUserData(ctx, func() error {
+			resyncs++
+			return nil
+		}, func(event *UserDataEvent) error {
+			if event.Order != nil {
+				cancel()
+			}
+			return nil
+		})
+		streamErrs = append(streamErrs, err)
+	}
+
+	if len(streamErrs) != 2 || streamErrs[1] != context.Canceled {
+		t.Fatalf("stream errors = %v, want the listen key to expire and then ctx to be done", streamErrs)
+	}
+	if resyncs != 2 {
+		t.Errorf("resynced %d times, want on both connects", resyncs)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fmt.Sprint(fake.connections) != "[key-1 key-2]" {
+		t.Errorf("connections = %v, want a new listen key for the reconnect", fake.connections)
+	}
+	if fmt.Sprint(fake.closedKeys) != "[key-1 key-2]" {
+		t.Errorf("closed listen keys = %v, want both", fake.closedKeys)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
 	"github.com/adshao/go-binance/v2/futures"
 	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
 )
@@ -16,49 +19,98 @@ type binanceFutures struct {
 	client    *futures.Client
 	ctx       *model.ScrapeCtx
 
-	UnderlyingTransport http.RoundTripper
+	// wsURL is the base url of user data streams
+	wsURL string
 }
 
-// RoundTrip implement http roundtrip
-func (e *binanceFutures) RoundTrip(req *http.Request) (*http.Response, error) {
-	resp, err := e.UnderlyingTransport.RoundTrip(req)
-	if resp != nil && resp.Header != nil {
-		weight, err := strconv.Atoi(resp.Header.Get("X-Mbx-Used-Weight-1m"))
-		if err != nil {
-			return resp, nil
-		}
+var binanceFuturesWeights = map[string][2]int32{
+	"/fapi/v1/ping":            {1, 1},
+	"/fapi/v1/time":            {1, 1},
+	"/fapi/v1/ticker/price":    {1, 2},
+	"/fapi/v1/exchangeInfo":    {1, 1},
+	"/fapi/v1/klines":          {5, 5},
+	"/fapi/v1/markPriceKlines": {5, 5},
+	"/fapi/v1/account":         {5, 5},
+	"/fapi/v1/openOrders":      {1, 40},
+	"/fapi/v1/income":          {30, 30},
+	"/fapi/v1/userTrades":      {5, 5},
+	"/fapi/v1/order":           {1, 1},
+	"/fapi/v1/allOrders":       {5, 5},
+	"/fapi/v1/listenKey":       {1, 1},
+}
 
-		e.ctx.WeightUsed = int32(weight)
-	}
+const (
+	binanceFuturesBaseURL = "https://fapi.binance.com"
+	binanceFuturesWsURL   = "wss://fstream.binance.com/ws"
+
+	// binanceFuturesHistoryWindow is the longest time range userTrades
+	// and allOrders accept.
+	binanceFuturesHistoryWindow = 7 * 24 * time.Hour
+	// binanceFuturesTradeRetention is how far back userTrades can be queried.
+	binanceFuturesTradeRetention = 180 * 24 * time.Hour
+	// binanceFuturesOrderRetention is how far back allOrders can be queried.
+	binanceFuturesOrderRetention = 90 * 24 * time.Hour
+
+	// binanceFuturesWeightLimit is the request weight used per minute, half
+	// of the 2400 binance allows, as other clients may share the key.
+	binanceFuturesWeightLimit = 1200
+)
 
-	return resp, err
+func init() {
+	Register(Definition{
+		Name:        "binance-futures",
+		Description: "Binance USD-M futures",
+		New:         NewBinanceFutures,
+		WeightLimit: binanceFuturesWeightLimit,
+		Capabilities: []Capability{
+			CapabilityPrices,
+			CapabilityBalance,
+			CapabilityAccount,
+			CapabilityPositions,
+			CapabilityOrders,
+			CapabilityIncome,
+			CapabilityTrades,
+			CapabilityTransfers,
+			CapabilityCandles,
+			CapabilitySymbols,
+			CapabilityFunding,
+			CapabilityUserData,
+		},
+	})
 }
 
-func NewBinanceFutures(portfolio *model.Portfolio, ctx *model.ScrapeCtx) (Exchange, error) {
+func NewBinanceFutures(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx) (Exchange, error) {
+	return newBinanceFutures(ctx, portfolio, scrapeCtx, binanceFuturesBaseURL, binanceFuturesWsURL, http.DefaultTransport)
+}
+
+// newBinanceFutures creates the exchange against the api at baseURL and
+// the streams at wsURL, so it can be pointed at fake servers.
+func newBinanceFutures(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx, baseURL, wsURL string, transport http.RoundTripper) (*binanceFutures, error) {
 	client := futures.NewClient(portfolio.APIKey, portfolio.APISecret)
-	err := client.NewPingService().Do(context.Background())
+	client.BaseURL = baseURL
+	client.HTTPClient = &http.Client{Transport: &binanceTransport{
+		weights:             binanceFuturesWeights,
+		ctx:                 scrapeCtx,
+		UnderlyingTransport: transport,
+	}}
+
+	err := client.NewPingService().Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to ping binance api: %v", err)
 	}
 
-	client.HTTPClient = &http.Client{Transport: &binanceFutures{
-		UnderlyingTransport: http.DefaultTransport,
-		ctx:                 ctx,
-	}}
-
 	exchange := &binanceFutures{
 		portfolio: portfolio,
 		client:    client,
-		ctx:       ctx,
-
-		UnderlyingTransport: http.DefaultTransport,
+		ctx:       scrapeCtx,
+		wsURL:     wsURL,
 	}
 
 	return exchange, nil
 }
 
-func (e *binanceFutures) GetSymbolPrices() ([]*model.SymbolPrice, error) {
-	prices, err := e.client.NewListPricesService().Do(context.Background())
+func (e *binanceFutures) GetSymbolPrices(ctx context.Context) ([]*model.SymbolPrice, error) {
+	prices, err := e.client.NewListPricesService().Do(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -76,17 +128,59 @@ func (e *binanceFutures) GetSymbolPrices() ([]*model.SymbolPrice, error) {
 	return result, nil
 }
 
-func (e *binanceFutures) GetBalance() (float64, error) {
-	account, err := e.client.NewGetAccountService().Do(context.Background())
+func (e *binanceFutures) GetBalance(ctx context.Context) (map[string]float64, error) {
+	account, err := e.client.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := strconv.ParseFloat(account.TotalWalletBalance, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]float64{model.QuoteAsset: balance}, nil
+}
+
+// GetAccount returns the margin state of the account. Account figures are
+// in model.QuoteAsset, which multi-asset mode values all assets in.
+func (e *binanceFutures) GetAccount(ctx context.Context) (*model.AccountSnapshot, error) {
+	var account struct {
+		TotalWalletBalance    string                 `json:"totalWalletBalance"`
+		TotalUnrealizedProfit string                 `json:"totalUnrealizedProfit"`
+		TotalMarginBalance    string                 `json:"totalMarginBalance"`
+		AvailableBalance      string                 `json:"availableBalance"`
+		TotalInitialMargin    string                 `json:"totalInitialMargin"`
+		TotalMaintMargin      string                 `json:"totalMaintMargin"`
+		Assets                []*binanceAccountAsset `json:"assets"`
+	}
+
+	if err := e.signedGet(ctx, "/fapi/v1/account", url.Values{}, &account); err != nil {
+		return nil, fmt.Errorf("failed to get account: %v", err)
+	}
+
+	snapshot, err := accountFigures{
+		Asset:            model.QuoteAsset,
+		WalletBalance:    account.TotalWalletBalance,
+		UnrealizedPnl:    account.TotalUnrealizedProfit,
+		MarginBalance:    account.TotalMarginBalance,
+		AvailableBalance: account.AvailableBalance,
+		InitialMargin:    account.TotalInitialMargin,
+		MaintMargin:      account.TotalMaintMargin,
+	}.toAccountSnapshot()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return strconv.ParseFloat(account.TotalWalletBalance, 64)
+	if snapshot.Assets, err = binanceAssetBalances(account.Assets); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
 }
 
-func (e *binanceFutures) GetPositions() ([]*model.Position, error) {
-	account, err := e.client.NewGetAccountService().Do(context.Background())
+func (e *binanceFutures) GetPositions(ctx context.Context) ([]*model.Position, error) {
+	account, err := e.client.NewGetAccountService().Do(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account: %v", err)
 	}
@@ -106,8 +200,8 @@ func (e *binanceFutures) GetPositions() ([]*model.Position, error) {
 	return positions, nil
 }
 
-func (e *binanceFutures) GetOrders() ([]*model.Order, error) {
-	rawOrders, err := e.client.NewListOpenOrdersService().Do(context.Background())
+func (e *binanceFutures) GetOrders(ctx context.Context) ([]*model.Order, error) {
+	rawOrders, err := e.client.NewListOpenOrdersService().Do(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -124,17 +218,67 @@ func (e *binanceFutures) GetOrders() ([]*model.Order, error) {
 	return orders, nil
 }
 
-func (e *binanceFutures) GetIncome() ([]*model.Income, error) {
+func (e *binanceFutures) GetOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
+	rawOrder, err := e.client.NewGetOrderService().
+		Symbol(order.Symbol).
+		OrderID(order.ID).
+		Do(ctx)
+	if err != nil {
+		if apiErr, ok := err.(*common.APIError); ok && apiErr.Code == binanceOrderNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e.parseOrder(rawOrder)
+}
+
+func (e *binanceFutures) GetOrdersBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Order, error) {
+	if oldest := time.Now().Add(-binanceFuturesOrderRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	var orders []*model.Order
+	err := binancePaginate(startTime, endTime, binanceFuturesHistoryWindow, func(start, end int64) (int, int64, error) {
+		rawOrders, err := e.client.NewListOrdersService().
+			Symbol(symbol).
+			StartTime(start).
+			EndTime(end).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil || len(rawOrders) == 0 {
+			return 0, 0, err
+		}
+
+		for _, rawOrder := range rawOrders {
+			order, err := e.parseOrder(rawOrder)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			orders = append(orders, order)
+		}
+
+		return len(rawOrders), rawOrders[len(rawOrders)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (e *binanceFutures) GetIncome(ctx context.Context) ([]*model.Income, error) {
 	service := e.client.NewGetIncomeHistoryService()
 
-	rawIncomes, err := service.Do(context.Background())
+	rawIncomes, err := service.Do(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var incomes []*model.Income
 	for _, rawIncome := range rawIncomes {
-		income, err := e.parseIncome(rawIncome)
+		income, err := parseBinanceIncome(rawIncome)
 		if err != nil {
 			return nil, err
 		}
@@ -145,8 +289,8 @@ func (e *binanceFutures) GetIncome() ([]*model.Income, error) {
 	return incomes, nil
 }
 
-func (e *binanceFutures) GetIncomeBetween(startTime, endTime int64) ([]*model.Income, error) {
-	service := e.client.NewGetIncomeHistoryService()
+func (e *binanceFutures) GetIncomeBetween(ctx context.Context, startTime, endTime int64) ([]*model.Income, error) {
+	service := e.client.NewGetIncomeHistoryService().Limit(1000)
 
 	if startTime > 0 {
 		service.StartTime(startTime)
@@ -156,14 +300,14 @@ func (e *binanceFutures) GetIncomeBetween(startTime, endTime int64) ([]*model.In
 		service.EndTime(endTime)
 	}
 
-	rawIncomes, err := service.Do(context.Background())
+	rawIncomes, err := service.Do(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var incomes []*model.Income
 	for _, rawIncome := range rawIncomes {
-		income, err := e.parseIncome(rawIncome)
+		income, err := parseBinanceIncome(rawIncome)
 		if err != nil {
 			return nil, err
 		}
@@ -174,6 +318,149 @@ func (e *binanceFutures) GetIncomeBetween(startTime, endTime int64) ([]*model.In
 	return incomes, nil
 }
 
+// GetTransfersBetween returns transfers between the futures wallet and
+// the other wallets of the account.
+func (e *binanceFutures) GetTransfersBetween(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	err := binancePaginate(binanceTransferStart(startTime), endTime, binanceTransferWindow, func(start, end int64) (int, int64, error) {
+		rawIncomes, err := e.client.NewGetIncomeHistoryService().
+			IncomeType("TRANSFER").
+			StartTime(start).
+			EndTime(end).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil || len(rawIncomes) == 0 {
+			return 0, 0, err
+		}
+
+		for _, rawIncome := range rawIncomes {
+			transfer, err := parseBinanceIncomeTransfer(rawIncome)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			transfers = append(transfers, transfer)
+		}
+
+		return len(rawIncomes), rawIncomes[len(rawIncomes)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+func (e *binanceFutures) GetTrades(ctx context.Context, symbol string) ([]*model.Trade, error) {
+	rawTrades, err := e.client.NewListAccountTradeService().
+		Symbol(symbol).
+		Limit(binanceHistoryLimit).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.parseTrades(rawTrades)
+}
+
+func (e *binanceFutures) GetTradesBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Trade, error) {
+	if oldest := time.Now().Add(-binanceFuturesTradeRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	var trades []*model.Trade
+	err := binancePaginate(startTime, endTime, binanceFuturesHistoryWindow, func(start, end int64) (int, int64, error) {
+		rawTrades, err := e.client.NewListAccountTradeService().
+			Symbol(symbol).
+			StartTime(start).
+			EndTime(end).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil || len(rawTrades) == 0 {
+			return 0, 0, err
+		}
+
+		page, err := e.parseTrades(rawTrades)
+		if err != nil {
+			return 0, 0, err
+		}
+		trades = append(trades, page...)
+
+		return len(rawTrades), rawTrades[len(rawTrades)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+func (e *binanceFutures) GetCandles(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]*model.Candle, error) {
+	klines, err := e.client.NewKlinesService().
+		Symbol(symbol).
+		Interval(interval).
+		StartTime(startTime).
+		EndTime(endTime).
+		Limit(binanceKlineLimit).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var candles []*model.Candle
+	for _, kline := range klines {
+		candle, err := parseBinanceKline(symbol, interval, (*binance.Kline)(kline))
+		if err != nil {
+			return nil, err
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+func (e *binanceFutures) GetFundingRates(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.FundingRate, error) {
+	return binanceFundingRates(ctx, e.client.HTTPClient, e.client.BaseURL, "/fapi/v1", symbol, startTime, endTime)
+}
+
+func (e *binanceFutures) GetSymbolInfos(ctx context.Context) ([]*model.SymbolInfo, error) {
+	exchangeInfo, err := e.client.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []*model.SymbolInfo
+	for _, symbol := range exchangeInfo.Symbols {
+		info, err := parseBinanceContract(symbol.Symbol, string(symbol.ContractType), symbol.Status,
+			symbol.OnboardDate, symbol.DeliveryDate, symbol.Filters)
+		if err != nil {
+			return nil, err
+		}
+
+		info.BaseAsset = symbol.BaseAsset
+		info.QuoteAsset = symbol.QuoteAsset
+		info.MarginAsset = symbol.MarginAsset
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (e *binanceFutures) parseTrades(rawTrades []*futures.AccountTrade) ([]*model.Trade, error) {
+	var trades []*model.Trade
+	for _, rawTrade := range rawTrades {
+		trade, err := e.parseTrade(rawTrade)
+		if err != nil {
+			return nil, err
+		}
+
+		trades = append(trades, trade)
+	}
+
+	return trades, nil
+}
+
 func (e *binanceFutures) parsePrice(sp *futures.SymbolPrice) (*model.SymbolPrice, error) {
 	price, err := strconv.ParseFloat(sp.Price, 64)
 	if err != nil {
@@ -238,21 +525,40 @@ func (e *binanceFutures) parseOrder(order *futures.Order) (*model.Order, error)
 		return nil, err
 	}
 
+	executed, err := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var avgPrice float64
+	if order.AvgPrice != "" {
+		avgPrice, err = strconv.ParseFloat(order.AvgPrice, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &model.Order{
-		ID:           order.OrderID,
-		Symbol:       order.Symbol,
-		Side:         string(order.Side),
-		PositionSide: string(order.PositionSide),
-		TimeInForce:  string(order.TimeInForce),
-		Type:         string(order.Type),
-		Price:        price,
-		Amount:       amount,
-		ReduceOnly:   order.ReduceOnly,
-		Date:         time.UnixMilli(order.Time),
+		ID:             order.OrderID,
+		Symbol:         order.Symbol,
+		Side:           string(order.Side),
+		PositionSide:   string(order.PositionSide),
+		TimeInForce:    string(order.TimeInForce),
+		Type:           string(order.Type),
+		Status:         string(order.Status),
+		Price:          price,
+		AvgPrice:       avgPrice,
+		Amount:         amount,
+		ExecutedAmount: executed,
+		ReduceOnly:     order.ReduceOnly,
+		Date:           time.UnixMilli(order.Time),
+		UpdateDate:     time.UnixMilli(order.UpdateTime),
 	}, nil
 }
 
-func (e *binanceFutures) parseIncome(income *futures.IncomeHistory) (*model.Income, error) {
+// parseBinanceIncome parses income of binance futures, usd-m and coin-m
+// income history share the same format.
+func parseBinanceIncome(income *futures.IncomeHistory) (*model.Income, error) {
 	pnl, err := strconv.ParseFloat(income.Income, 64)
 	if err != nil {
 		return nil, err
@@ -277,3 +583,51 @@ func (e *binanceFutures) parseIncome(income *futures.IncomeHistory) (*model.Inco
 		Date:    time.UnixMilli(income.Time),
 	}, nil
 }
+
+func (e *binanceFutures) parseTrade(trade *futures.AccountTrade) (*model.Trade, error) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	quoteAmount, err := strconv.ParseFloat(trade.QuoteQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	commission, err := strconv.ParseFloat(trade.Commission, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	pnl, err := strconv.ParseFloat(trade.RealizedPnl, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Trade{
+		ID:              trade.ID,
+		Symbol:          trade.Symbol,
+		OrderID:         trade.OrderID,
+		Side:            string(trade.Side),
+		PositionSide:    string(trade.PositionSide),
+		Price:           price,
+		Amount:          amount,
+		QuoteAmount:     quoteAmount,
+		Commission:      commission,
+		CommissionAsset: trade.CommissionAsset,
+		RealizedPnl:     pnl,
+		Buyer:           trade.Buyer,
+		Maker:           trade.Maker,
+		Date:            time.UnixMilli(trade.Time),
+	}, nil
+}
+
+func (e *binanceFutures) signedGet(ctx context.Context, endpoint string, params url.Values, result interface{}) error {
+	return binanceSignedGet(ctx, e.client.HTTPClient, e.client.BaseURL, endpoint, e.portfolio, params, result)
+}
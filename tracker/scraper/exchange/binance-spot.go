@@ -0,0 +1,659 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+type binanceSpot struct {
+	portfolio *model.Portfolio
+	client    *binance.Client
+	ctx       *model.ScrapeCtx
+}
+
+var binanceSpotWeights = map[string][2]int32{
+	"/api/v3/ping":         {1, 1},
+	"/api/v3/time":         {1, 1},
+	"/api/v3/ticker/price": {1, 2},
+	"/api/v3/exchangeInfo": {20, 20},
+	"/api/v3/klines":       {2, 2},
+	"/api/v3/account":      {10, 10},
+	"/api/v3/openOrders":   {3, 40},
+	"/api/v3/order":        {2, 2},
+	"/api/v3/allOrders":    {10, 10},
+	"/api/v3/myTrades":     {10, 10},
+
+	"/sapi/v1/capital/deposit/hisrec":   {1, 1},
+	"/sapi/v1/capital/withdraw/history": {10, 10},
+	"/sapi/v1/asset/transfer":           {1, 1},
+}
+
+// binanceSpotStatuses maps symbol statuses of binance spot. Symbols are
+// on break when they are delisted, other statuses halt trading for a time.
+var binanceSpotStatuses = map[string]string{
+	"PRE_TRADING": model.SymbolStatusPending,
+	"TRADING":     model.SymbolStatusTrading,
+	"BREAK":       model.SymbolStatusDelisted,
+}
+
+const (
+	// binanceSpotHistoryWindow is the longest time range myTrades and
+	// allOrders accept.
+	binanceSpotHistoryWindow = 24 * time.Hour
+	// binanceSpotQuote is the asset the markets of held assets are looked
+	// up against.
+	binanceSpotQuote = "USDT"
+
+	// binanceSpotWeightLimit is the request weight used per minute, half of
+	// the 6000 binance allows, as other clients may share the key.
+	binanceSpotWeightLimit = 3000
+)
+
+const (
+	binanceSpotDepositSuccess      = 1
+	binanceSpotWithdrawalCompleted = 6
+	// binanceSpotTransferPageSize is the largest page of universal transfers.
+	binanceSpotTransferPageSize = 100
+)
+
+// binanceSpotTransferTypes are the universal transfer types between the
+// spot and futures wallets, and the direction they move funds in for the
+// spot wallet.
+var binanceSpotTransferTypes = [][2]string{
+	{"MAIN_UMFUTURE", model.TransferOut},
+	{"UMFUTURE_MAIN", model.TransferIn},
+	{"MAIN_CMFUTURE", model.TransferOut},
+	{"CMFUTURE_MAIN", model.TransferIn},
+}
+
+func init() {
+	Register(Definition{
+		Name:        "binance-spot",
+		Description: "Binance spot wallet",
+		New:         NewBinanceSpot,
+		WeightLimit: binanceSpotWeightLimit,
+		Capabilities: []Capability{
+			CapabilityPrices,
+			CapabilityBalance,
+			CapabilityOrders,
+			CapabilityTrades,
+			CapabilityTransfers,
+			CapabilityCandles,
+			CapabilitySymbols,
+		},
+	})
+}
+
+func NewBinanceSpot(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx) (Exchange, error) {
+	client := binance.NewClient(portfolio.APIKey, portfolio.APISecret)
+	client.HTTPClient = &http.Client{Transport: &binanceTransport{
+		weights:             binanceSpotWeights,
+		ctx:                 scrapeCtx,
+		UnderlyingTransport: http.DefaultTransport,
+	}}
+
+	err := client.NewPingService().Do(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping binance api: %v", err)
+	}
+
+	exchange := &binanceSpot{
+		portfolio: portfolio,
+		client:    client,
+		ctx:       scrapeCtx,
+	}
+
+	return exchange, nil
+}
+
+func (e *binanceSpot) GetSymbolPrices(ctx context.Context) ([]*model.SymbolPrice, error) {
+	prices, err := e.client.NewListPricesService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*model.SymbolPrice
+	for _, price := range prices {
+		p, err := strconv.ParseFloat(price.Price, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &model.SymbolPrice{Symbol: price.Symbol, Price: p})
+	}
+
+	return result, nil
+}
+
+// GetBalance returns the free and locked amount of every wallet asset.
+func (e *binanceSpot) GetBalance(ctx context.Context) (map[string]float64, error) {
+	account, err := e.client.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := map[string]float64{}
+	for _, balance := range account.Balances {
+		amount, err := e.parseBalance(balance)
+		if err != nil {
+			return nil, err
+		}
+
+		if amount != 0 {
+			balances[balance.Asset] = amount
+		}
+	}
+
+	return balances, nil
+}
+
+func (e *binanceSpot) GetOrders(ctx context.Context) ([]*model.Order, error) {
+	rawOrders, err := e.client.NewListOpenOrdersService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*model.Order
+	for _, rawOrder := range rawOrders {
+		order, err := e.parseOrder(rawOrder)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+func (e *binanceSpot) GetOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
+	rawOrder, err := e.client.NewGetOrderService().
+		Symbol(order.Symbol).
+		OrderID(order.ID).
+		Do(ctx)
+	if err != nil {
+		if apiErr, ok := err.(*common.APIError); ok && apiErr.Code == binanceOrderNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return e.parseOrder(rawOrder)
+}
+
+func (e *binanceSpot) GetOrdersBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Order, error) {
+	var orders []*model.Order
+	err := binancePaginate(startTime, endTime, binanceSpotHistoryWindow, func(start, end int64) (int, int64, error) {
+		rawOrders, err := e.client.NewListOrdersService().
+			Symbol(symbol).
+			StartTime(start).
+			EndTime(end).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil || len(rawOrders) == 0 {
+			return 0, 0, err
+		}
+
+		for _, rawOrder := range rawOrders {
+			order, err := e.parseOrder(rawOrder)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			orders = append(orders, order)
+		}
+
+		return len(rawOrders), rawOrders[len(rawOrders)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (e *binanceSpot) GetTrades(ctx context.Context, symbol string) ([]*model.Trade, error) {
+	rawTrades, err := e.client.NewListTradesService().
+		Symbol(symbol).
+		Limit(binanceHistoryLimit).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.parseTrades(rawTrades)
+}
+
+func (e *binanceSpot) GetTradesBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Trade, error) {
+	var trades []*model.Trade
+	err := binancePaginate(startTime, endTime, binanceSpotHistoryWindow, func(start, end int64) (int, int64, error) {
+		rawTrades, err := e.client.NewListTradesService().
+			Symbol(symbol).
+			StartTime(start).
+			EndTime(end).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil || len(rawTrades) == 0 {
+			return 0, 0, err
+		}
+
+		page, err := e.parseTrades(rawTrades)
+		if err != nil {
+			return 0, 0, err
+		}
+		trades = append(trades, page...)
+
+		return len(rawTrades), rawTrades[len(rawTrades)-1].Time, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+// GetTransfersBetween returns completed deposits and withdrawals, and
+// transfers between the spot and futures wallets.
+func (e *binanceSpot) GetTransfersBetween(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	err := binancePaginate(binanceTransferStart(startTime), endTime, binanceTransferWindow, func(start, end int64) (int, int64, error) {
+		deposits, err := e.getDeposits(ctx, start, end)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		withdrawals, err := e.getWithdrawals(ctx, start, end)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		walletTransfers, err := e.getWalletTransfers(ctx, start, end)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		transfers = append(transfers, deposits...)
+		transfers = append(transfers, withdrawals...)
+		transfers = append(transfers, walletTransfers...)
+
+		// every window is paged through above
+		return 0, 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+func (e *binanceSpot) getDeposits(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	for offset := 0; ; {
+		deposits, err := e.client.NewListDepositsService().
+			Status(binanceSpotDepositSuccess).
+			StartTime(startTime).
+			EndTime(endTime).
+			Offset(offset).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, deposit := range deposits {
+			amount, err := strconv.ParseFloat(deposit.Amount, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			transfers = append(transfers, &model.Transfer{
+				ExternalID: deposit.TxID,
+				Type:       model.TransferDeposit,
+				Asset:      deposit.Coin,
+				Amount:     amount,
+				Date:       time.UnixMilli(deposit.InsertTime),
+			})
+		}
+
+		if len(deposits) < binanceHistoryLimit {
+			return transfers, nil
+		}
+		offset += len(deposits)
+	}
+}
+
+func (e *binanceSpot) getWithdrawals(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	for offset := 0; ; {
+		withdrawals, err := e.client.NewListWithdrawsService().
+			Status(binanceSpotWithdrawalCompleted).
+			StartTime(startTime).
+			EndTime(endTime).
+			Offset(offset).
+			Limit(binanceHistoryLimit).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, withdrawal := range withdrawals {
+			amount, err := strconv.ParseFloat(withdrawal.Amount, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			fee, err := strconv.ParseFloat(withdrawal.TransactionFee, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			date, err := time.Parse("2006-01-02 15:04:05", withdrawal.ApplyTime)
+			if err != nil {
+				return nil, err
+			}
+
+			transfers = append(transfers, &model.Transfer{
+				ExternalID: withdrawal.ID,
+				Type:       model.TransferWithdrawal,
+				Asset:      withdrawal.Coin,
+				Amount:     -(amount + fee),
+				Date:       date,
+			})
+		}
+
+		if len(withdrawals) < binanceHistoryLimit {
+			return transfers, nil
+		}
+		offset += len(withdrawals)
+	}
+}
+
+type binanceSpotTransfer struct {
+	TranID    int64  `json:"tranId"`
+	Asset     string `json:"asset"`
+	Amount    string `json:"amount"`
+	Status    string `json:"status"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// getWalletTransfers returns transfers between the spot and futures
+// wallets of the account.
+func (e *binanceSpot) getWalletTransfers(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	var transfers []*model.Transfer
+	for _, transferType := range binanceSpotTransferTypes {
+		for current := 1; ; current++ {
+			params := url.Values{
+				"type":      {transferType[0]},
+				"startTime": {strconv.FormatInt(startTime, 10)},
+				"endTime":   {strconv.FormatInt(endTime, 10)},
+				"current":   {strconv.Itoa(current)},
+				"size":      {strconv.Itoa(binanceSpotTransferPageSize)},
+			}
+
+			var page struct {
+				Rows []*binanceSpotTransfer `json:"rows"`
+			}
+			if err := binanceSignedGet(ctx, e.client.HTTPClient, e.client.BaseURL, "/sapi/v1/asset/transfer", e.portfolio, params, &page); err != nil {
+				return nil, err
+			}
+
+			for _, row := range page.Rows {
+				if row.Status != "CONFIRMED" {
+					continue
+				}
+
+				amount, err := strconv.ParseFloat(row.Amount, 64)
+				if err != nil {
+					return nil, err
+				}
+
+				if transferType[1] == model.TransferOut {
+					amount = -amount
+				}
+
+				transfers = append(transfers, &model.Transfer{
+					ExternalID: strconv.FormatInt(row.TranID, 10),
+					Type:       transferType[1],
+					Asset:      row.Asset,
+					Amount:     amount,
+					Date:       time.UnixMilli(row.Timestamp),
+				})
+			}
+
+			if len(page.Rows) < binanceSpotTransferPageSize {
+				break
+			}
+		}
+	}
+
+	return transfers, nil
+}
+
+func (e *binanceSpot) GetCandles(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]*model.Candle, error) {
+	klines, err := e.client.NewKlinesService().
+		Symbol(symbol).
+		Interval(interval).
+		StartTime(startTime).
+		EndTime(endTime).
+		Limit(binanceKlineLimit).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var candles []*model.Candle
+	for _, kline := range klines {
+		candle, err := parseBinanceKline(symbol, interval, kline)
+		if err != nil {
+			return nil, err
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+func (e *binanceSpot) GetSymbolInfos(ctx context.Context) ([]*model.SymbolInfo, error) {
+	exchangeInfo, err := e.client.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []*model.SymbolInfo
+	for _, symbol := range exchangeInfo.Symbols {
+		info := &model.SymbolInfo{
+			Symbol:       symbol.Symbol,
+			BaseAsset:    symbol.BaseAsset,
+			QuoteAsset:   symbol.QuoteAsset,
+			ContractType: "SPOT",
+			Status:       binanceSpotStatuses[symbol.Status],
+		}
+
+		if info.Status == "" {
+			info.Status = model.SymbolStatusHalted
+		}
+
+		if info.TickSize, err = binanceFilterValue(symbol.Filters, "tickSize", "PRICE_FILTER"); err != nil {
+			return nil, err
+		}
+
+		if info.LotSize, err = binanceFilterValue(symbol.Filters, "stepSize", "LOT_SIZE"); err != nil {
+			return nil, err
+		}
+
+		if info.MinNotional, err = binanceFilterValue(symbol.Filters, "minNotional", "NOTIONAL", "MIN_NOTIONAL"); err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// GetAccountSymbols returns the markets of the assets held in the wallet,
+// so their trades and orders can be scraped before any are stored.
+func (e *binanceSpot) GetAccountSymbols(ctx context.Context) ([]string, error) {
+	account, err := e.client.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prices, err := e.getPriceTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var symbols []string
+	for _, balance := range account.Balances {
+		amount, err := e.parseBalance(balance)
+		if err != nil {
+			return nil, err
+		}
+
+		if amount == 0 || balance.Asset == binanceSpotQuote {
+			continue
+		}
+
+		if _, ok := prices[balance.Asset+binanceSpotQuote]; ok {
+			symbols = append(symbols, balance.Asset+binanceSpotQuote)
+		}
+	}
+
+	return symbols, nil
+}
+
+func (e *binanceSpot) getPriceTable(ctx context.Context) (map[string]float64, error) {
+	prices, err := e.GetSymbolPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(map[string]float64, len(prices))
+	for _, price := range prices {
+		table[price.Symbol] = price.Price
+	}
+
+	return table, nil
+}
+
+func (e *binanceSpot) parseBalance(balance binance.Balance) (float64, error) {
+	free, err := strconv.ParseFloat(balance.Free, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	locked, err := strconv.ParseFloat(balance.Locked, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return free + locked, nil
+}
+
+func (e *binanceSpot) parseOrder(order *binance.Order) (*model.Order, error) {
+	price, err := strconv.ParseFloat(order.Price, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := strconv.ParseFloat(order.OrigQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	executed, err := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	var avgPrice float64
+	if executed > 0 {
+		quote, err := strconv.ParseFloat(order.CummulativeQuoteQuantity, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		avgPrice = quote / executed
+	}
+
+	return &model.Order{
+		ID:             order.OrderID,
+		Symbol:         order.Symbol,
+		Side:           string(order.Side),
+		TimeInForce:    string(order.TimeInForce),
+		Type:           string(order.Type),
+		Status:         string(order.Status),
+		Price:          price,
+		AvgPrice:       avgPrice,
+		Amount:         amount,
+		ExecutedAmount: executed,
+		Date:           time.UnixMilli(order.Time),
+		UpdateDate:     time.UnixMilli(order.UpdateTime),
+	}, nil
+}
+
+func (e *binanceSpot) parseTrades(rawTrades []*binance.TradeV3) ([]*model.Trade, error) {
+	var trades []*model.Trade
+	for _, rawTrade := range rawTrades {
+		trade, err := e.parseTrade(rawTrade)
+		if err != nil {
+			return nil, err
+		}
+
+		trades = append(trades, trade)
+	}
+
+	return trades, nil
+}
+
+func (e *binanceSpot) parseTrade(trade *binance.TradeV3) (*model.Trade, error) {
+	price, err := strconv.ParseFloat(trade.Price, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := strconv.ParseFloat(trade.Quantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	quoteAmount, err := strconv.ParseFloat(trade.QuoteQuantity, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	commission, err := strconv.ParseFloat(trade.Commission, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	side := string(binance.SideTypeSell)
+	if trade.IsBuyer {
+		side = string(binance.SideTypeBuy)
+	}
+
+	return &model.Trade{
+		ID:              trade.ID,
+		Symbol:          trade.Symbol,
+		OrderID:         trade.OrderID,
+		Side:            side,
+		Price:           price,
+		Amount:          amount,
+		QuoteAmount:     quoteAmount,
+		Commission:      commission,
+		CommissionAsset: trade.CommissionAsset,
+		Buyer:           trade.IsBuyer,
+		Maker:           trade.IsMaker,
+		Date:            time.UnixMilli(trade.Time),
+	}, nil
+}
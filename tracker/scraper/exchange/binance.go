@@ -0,0 +1,466 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+const (
+	binanceHistoryLimit  = 1000
+	binanceOrderNotFound = -2013
+
+	// binanceKlineLimit is the page size klines are requested in, the
+	// largest before their request weight goes up.
+	binanceKlineLimit = 1000
+)
+
+// binanceTransientCodes are the error codes of requests that may succeed
+// when retried: unknown and internal errors, backend timeouts, rate limits
+// and timestamps outside of the receive window.
+var binanceTransientCodes = map[int64]bool{
+	-1000: true,
+	-1001: true,
+	-1003: true,
+	-1006: true,
+	-1007: true,
+	-1021: true,
+}
+
+// binanceAuthCodes are the error codes of requests refused for the API
+// key: invalid signatures, and invalid keys, IPs or permissions.
+var binanceAuthCodes = map[int64]bool{
+	-1022: true,
+	-2014: true,
+	-2015: true,
+}
+
+// binanceTransport reserves the request weight of an endpoint before the
+// request is sent, and syncs the budget with the weight binance reports.
+type binanceTransport struct {
+	// weights holds request weights of endpoints as
+	// {with symbol, without symbol}.
+	weights map[string][2]int32
+	ctx     *model.ScrapeCtx
+
+	UnderlyingTransport http.RoundTripper
+}
+
+// RoundTrip implement http roundtrip
+func (t *binanceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.ctx.ReserveWeight(req.Context(), t.weight(req)); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.UnderlyingTransport.RoundTrip(req)
+	if resp == nil || resp.Header == nil {
+		return resp, err
+	}
+
+	if weight, err := strconv.Atoi(resp.Header.Get("X-Mbx-Used-Weight-1m")); err == nil {
+		t.ctx.Weight.Sync(int32(weight))
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		t.ctx.Weight.Backoff(retryAfter(resp.Header))
+	}
+
+	if err := serverError(resp); err != nil {
+		return nil, err
+	}
+
+	return resp, err
+}
+
+func (t *binanceTransport) weight(req *http.Request) int32 {
+	weights, ok := t.weights[req.URL.Path]
+	if !ok {
+		return 1
+	}
+
+	if req.URL.Query().Get("symbol") != "" {
+		return weights[0]
+	}
+
+	return weights[1]
+}
+
+const (
+	// binanceTransferWindow is the time range transfer history is queried in.
+	binanceTransferWindow = 30 * 24 * time.Hour
+	// binanceTransferRetention is how far back transfer history is queried.
+	binanceTransferRetention = 365 * 24 * time.Hour
+)
+
+// binanceTransferStart limits the start of a transfer history query to
+// binanceTransferRetention.
+func binanceTransferStart(startTime int64) int64 {
+	if oldest := time.Now().Add(-binanceTransferRetention).UnixMilli(); startTime < oldest {
+		return oldest
+	}
+
+	return startTime
+}
+
+// parseBinanceIncomeTransfer parses a TRANSFER income record of binance
+// futures, which moves funds between the futures and spot wallets.
+func parseBinanceIncomeTransfer(income *futures.IncomeHistory) (*model.Transfer, error) {
+	amount, err := strconv.ParseFloat(income.Income, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	transferType := model.TransferIn
+	if amount < 0 {
+		transferType = model.TransferOut
+	}
+
+	return &model.Transfer{
+		ExternalID: strconv.FormatInt(income.TranID, 10),
+		Type:       transferType,
+		Asset:      income.Asset,
+		Amount:     amount,
+		Date:       time.UnixMilli(income.Time),
+	}, nil
+}
+
+// parseBinanceKline parses a kline of any binance market. The markets'
+// kline types are identical, and are converted to the spot one.
+func parseBinanceKline(symbol, interval string, kline *binance.Kline) (*model.Candle, error) {
+	candle := &model.Candle{
+		Symbol:   symbol,
+		Interval: interval,
+		OpenTime: time.UnixMilli(kline.OpenTime),
+	}
+
+	values := []struct {
+		raw   string
+		value *float64
+	}{
+		{kline.Open, &candle.Open},
+		{kline.High, &candle.High},
+		{kline.Low, &candle.Low},
+		{kline.Close, &candle.Close},
+		{kline.Volume, &candle.Volume},
+		{kline.QuoteAssetVolume, &candle.QuoteVolume},
+	}
+	for _, v := range values {
+		parsed, err := strconv.ParseFloat(v.raw, 64)
+		if err != nil {
+			return nil, err
+		}
+		*v.value = parsed
+	}
+
+	return candle, nil
+}
+
+// binancePerpetualDeliveryDate is the delivery date binance futures give
+// perpetual contracts, until they are set to be delisted.
+var binancePerpetualDeliveryDate = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var binanceContractStatuses = map[string]string{
+	"PENDING_TRADING": model.SymbolStatusPending,
+	"TRADING":         model.SymbolStatusTrading,
+	"PRE_DELIVERING":  model.SymbolStatusDelisting,
+	"DELIVERING":      model.SymbolStatusDelisting,
+	"DELIVERED":       model.SymbolStatusDelisted,
+	"PRE_SETTLE":      model.SymbolStatusDelisting,
+	"SETTLING":        model.SymbolStatusDelisting,
+	"CLOSE":           model.SymbolStatusDelisted,
+}
+
+// parseBinanceContract parses the symbol info of a binance futures
+// contract, from the fields usd-m and coin-m futures share.
+func parseBinanceContract(symbol, contractType, status string, onboardDate, deliveryDate int64, filters []map[string]interface{}) (*model.SymbolInfo, error) {
+	info := &model.SymbolInfo{
+		Symbol:       symbol,
+		ContractType: contractType,
+		Status:       binanceContractStatuses[status],
+		ListDate:     time.UnixMilli(onboardDate),
+		DelistDate:   time.UnixMilli(deliveryDate),
+	}
+
+	if info.Status == "" {
+		info.Status = model.SymbolStatusHalted
+	}
+
+	if contractType == "PERPETUAL" {
+		if info.DelistDate.After(binancePerpetualDeliveryDate) {
+			info.DelistDate = time.Time{}
+		} else if info.Status == model.SymbolStatusTrading {
+			info.Status = model.SymbolStatusDelisting
+		}
+	}
+
+	var err error
+	if info.TickSize, err = binanceFilterValue(filters, "tickSize", "PRICE_FILTER"); err != nil {
+		return nil, err
+	}
+
+	if info.LotSize, err = binanceFilterValue(filters, "stepSize", "LOT_SIZE"); err != nil {
+		return nil, err
+	}
+
+	if info.MinNotional, err = binanceFilterValue(filters, "notional", "MIN_NOTIONAL"); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// binanceFilterValue returns the value of key in the first of the symbol
+// filters of one of the types, or 0 if there is none.
+func binanceFilterValue(filters []map[string]interface{}, key string, filterTypes ...string) (float64, error) {
+	for _, filterType := range filterTypes {
+		for _, filter := range filters {
+			if filter["filterType"] != filterType {
+				continue
+			}
+
+			value, ok := filter[key].(string)
+			if !ok {
+				return 0, nil
+			}
+
+			return strconv.ParseFloat(value, 64)
+		}
+	}
+
+	return 0, nil
+}
+
+// binancePaginate walks the time range between startTime and endTime in
+// windows and pages the history endpoints accept. fetch returns the size
+// of the page and the time of its last record.
+func binancePaginate(startTime, endTime int64, window time.Duration, fetch func(start, end int64) (int, int64, error)) error {
+	for startTime <= endTime {
+		windowEnd := startTime + window.Milliseconds() - 1
+		if windowEnd > endTime {
+			windowEnd = endTime
+		}
+
+		n, last, err := fetch(startTime, windowEnd)
+		if err != nil {
+			return err
+		}
+
+		if n < binanceHistoryLimit {
+			startTime = windowEnd + 1
+			continue
+		}
+
+		// the window has more records, continue from the last one,
+		// duplicates sharing its timestamp are upserted by the scraper
+		if last <= startTime {
+			last = startTime + 1
+		}
+		startTime = last
+	}
+
+	return nil
+}
+
+// binanceSignedGet sends a signed GET request to endpoints the binance
+// client has no service for, and decodes the response into result.
+func binanceSignedGet(ctx context.Context, client *http.Client, baseURL, endpoint string, portfolio *model.Portfolio, params url.Values, result interface{}) error {
+	params.Set("timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+	query := params.Encode()
+
+	mac := hmac.New(sha256.New, []byte(portfolio.APISecret))
+	mac.Write([]byte(query))
+
+	fullURL := fmt.Sprintf("%s%s?%s&signature=%x", baseURL, endpoint, query, mac.Sum(nil))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fullURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-MBX-APIKEY", portfolio.APIKey)
+
+	return binanceDo(client, req, result)
+}
+
+// binancePublicGet is binanceSignedGet for public endpoints.
+func binancePublicGet(ctx context.Context, client *http.Client, baseURL, endpoint string, params url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	return binanceDo(client, req, result)
+}
+
+func binanceDo(client *http.Client, req *http.Request, result interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &common.APIError{}
+		if err := json.Unmarshal(body, apiErr); err != nil {
+			return fmt.Errorf("unexpected response, status %d: %s", resp.StatusCode, body)
+		}
+		return apiErr
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// binanceFundingLimit is the largest page of funding rates.
+const binanceFundingLimit = 1000
+
+type binanceFundingRate struct {
+	FundingTime int64  `json:"fundingTime"`
+	FundingRate string `json:"fundingRate"`
+	// MarkPrice is only published by usd-m futures, and is empty for
+	// older rates.
+	MarkPrice string `json:"markPrice"`
+}
+
+// binanceFundingRates gets a page of funding rates of the symbol from the
+// binance futures api under prefix, such as /fapi/v1, and fills in mark
+// prices it did not publish from its mark price klines.
+func binanceFundingRates(ctx context.Context, client *http.Client, baseURL, prefix, symbol string, startTime, endTime int64) ([]*model.FundingRate, error) {
+	var rawRates []*binanceFundingRate
+	params := url.Values{
+		"symbol":    {symbol},
+		"startTime": {strconv.FormatInt(startTime, 10)},
+		"endTime":   {strconv.FormatInt(endTime, 10)},
+		"limit":     {strconv.Itoa(binanceFundingLimit)},
+	}
+	if err := binancePublicGet(ctx, client, baseURL, prefix+"/fundingRate", params, &rawRates); err != nil {
+		return nil, err
+	}
+
+	var rates []*model.FundingRate
+	for _, rawRate := range rawRates {
+		rate, err := strconv.ParseFloat(rawRate.FundingRate, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		var markPrice float64
+		if rawRate.MarkPrice != "" {
+			if markPrice, err = strconv.ParseFloat(rawRate.MarkPrice, 64); err != nil {
+				return nil, err
+			}
+		}
+
+		rates = append(rates, &model.FundingRate{
+			Symbol:    symbol,
+			Date:      time.UnixMilli(rawRate.FundingTime),
+			Rate:      rate,
+			MarkPrice: markPrice,
+		})
+	}
+
+	err := fillMarkPrices(rates, func(start, end int64) ([]*model.Candle, error) {
+		return binanceMarkPriceKlines(ctx, client, baseURL, prefix, symbol, start, end)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// binanceMarkPriceKlines gets a page of hourly mark price klines of the
+// symbol, which the binance client has no service for.
+func binanceMarkPriceKlines(ctx context.Context, client *http.Client, baseURL, prefix, symbol string, startTime, endTime int64) ([]*model.Candle, error) {
+	// coin-m klines are limited to shorter ranges than a page spans
+	if pageEnd := startTime + binanceKlineLimit*time.Hour.Milliseconds() - 1; endTime > pageEnd {
+		endTime = pageEnd
+	}
+
+	// klines are [open time, open, high, low, close, ...], with times sent
+	// as numbers and prices as strings
+	var klines [][]json.RawMessage
+	params := url.Values{
+		"symbol":    {symbol},
+		"interval":  {"1h"},
+		"startTime": {strconv.FormatInt(startTime, 10)},
+		"endTime":   {strconv.FormatInt(endTime, 10)},
+		"limit":     {strconv.Itoa(binanceKlineLimit)},
+	}
+	if err := binancePublicGet(ctx, client, baseURL, prefix+"/markPriceKlines", params, &klines); err != nil {
+		return nil, err
+	}
+
+	var candles []*model.Candle
+	for _, kline := range klines {
+		if len(kline) < 5 {
+			return nil, fmt.Errorf("unexpected kline: %s", kline)
+		}
+
+		fields := []string{string(kline[0]), "", "", "", ""}
+		for i := 1; i < len(fields); i++ {
+			if err := json.Unmarshal(kline[i], &fields[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		candle, err := parseKline(symbol, "1h", fields)
+		if err != nil {
+			return nil, err
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
+
+// binanceAccountAsset is an asset of a futures or delivery account.
+type binanceAccountAsset struct {
+	Asset            string `json:"asset"`
+	WalletBalance    string `json:"walletBalance"`
+	UnrealizedProfit string `json:"unrealizedProfit"`
+	MarginBalance    string `json:"marginBalance"`
+	AvailableBalance string `json:"availableBalance"`
+	InitialMargin    string `json:"initialMargin"`
+	MaintMargin      string `json:"maintMargin"`
+}
+
+// binanceAssetBalances parses the assets the account holds.
+func binanceAssetBalances(assets []*binanceAccountAsset) ([]*model.AssetBalance, error) {
+	var balances []*model.AssetBalance
+	for _, asset := range assets {
+		balance, err := accountFigures{
+			Asset:            asset.Asset,
+			WalletBalance:    asset.WalletBalance,
+			UnrealizedPnl:    asset.UnrealizedProfit,
+			MarginBalance:    asset.MarginBalance,
+			AvailableBalance: asset.AvailableBalance,
+			InitialMargin:    asset.InitialMargin,
+			MaintMargin:      asset.MaintMargin,
+		}.toAssetBalance()
+		if err != nil {
+			return nil, err
+		}
+
+		if !balance.IsEmpty() {
+			balances = append(balances, balance)
+		}
+	}
+
+	return balances, nil
+}
@@ -0,0 +1,1261 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+const (
+	bybitBaseURL     = "https://api.bybit.com"
+	bybitRecvWindow  = "5000"
+	bybitCategory    = "linear"
+	bybitSettleCoin  = "USDT"
+	bybitAccountType = "UNIFIED"
+
+	// bybitHistoryWindow is the longest time range history endpoints accept.
+	bybitHistoryWindow = 7 * 24 * time.Hour
+	// bybitHistoryRetention is how far back history endpoints can be queried.
+	bybitHistoryRetention = 730 * 24 * time.Hour
+
+	// bybitKlineLimit is the largest page of klines.
+	bybitKlineLimit = 1000
+	// bybitFundingLimit is the largest page of funding rates. Symbols are
+	// funded at most hourly, so a page spans at least as many hours.
+	bybitFundingLimit = 200
+
+	bybitRateLimited = 10006
+
+	// bybitWeightLimit is the number of requests made per minute, half of
+	// the 10 per second bybit allows on most private endpoints.
+	bybitWeightLimit = 300
+)
+
+// bybitTransientCodes are the error codes of requests that may succeed
+// when retried: timestamps outside of the receive window, rate limits and
+// server errors.
+var bybitTransientCodes = map[int64]bool{
+	10002:            true,
+	bybitRateLimited: true,
+	10016:            true,
+}
+
+// bybitAuthCodes are the error codes of requests refused for the API key:
+// invalid or expired keys, invalid signatures and missing permissions.
+var bybitAuthCodes = map[int64]bool{
+	10003: true,
+	10004: true,
+	10005: true,
+	10007: true,
+	33004: true,
+}
+
+var bybitSymbolStatuses = map[string]string{
+	"PreLaunch":  model.SymbolStatusPending,
+	"Trading":    model.SymbolStatusTrading,
+	"Settling":   model.SymbolStatusHalted,
+	"Delivering": model.SymbolStatusDelisting,
+	"Closed":     model.SymbolStatusDelisted,
+}
+
+var bybitContractTypes = map[string]string{
+	"LinearPerpetual": "PERPETUAL",
+	"LinearFutures":   "FUTURES",
+}
+
+var bybitKlineIntervals = map[string]string{
+	"1m":  "1",
+	"5m":  "5",
+	"15m": "15",
+	"30m": "30",
+	"1h":  "60",
+	"4h":  "240",
+	"1d":  "D",
+}
+
+var bybitOrderStatuses = map[string]string{
+	"New":                     model.OrderStatusNew,
+	"Untriggered":             model.OrderStatusNew,
+	"Triggered":               model.OrderStatusNew,
+	"PartiallyFilled":         model.OrderStatusPartiallyFilled,
+	"Filled":                  model.OrderStatusFilled,
+	"Cancelled":               model.OrderStatusCanceled,
+	"PartiallyFilledCanceled": model.OrderStatusCanceled,
+	"Deactivated":             model.OrderStatusCanceled,
+	"Rejected":                model.OrderStatusRejected,
+}
+
+var bybitPositionSides = map[int]string{
+	0: "BOTH",
+	1: "LONG",
+	2: "SHORT",
+}
+
+type BybitAPIError struct {
+	Code    int64
+	Message string
+}
+
+func (e *BybitAPIError) Error() string {
+	return fmt.Sprintf("<BybitAPIError> code=%d, msg=%s", e.Code, e.Message)
+}
+
+// Transient reports whether the request may succeed when retried.
+func (e *BybitAPIError) Transient() bool {
+	return bybitTransientCodes[e.Code]
+}
+
+// Auth reports whether the request was refused for the API key.
+func (e *BybitAPIError) Auth() bool {
+	return bybitAuthCodes[e.Code]
+}
+
+type bybitLinear struct {
+	portfolio *model.Portfolio
+	ctx       *model.ScrapeCtx
+	client    *http.Client
+	baseURL   string
+}
+
+// bybitTransport reserves request weight before a request is sent, and
+// backs off when bybit reports the rate limit of an endpoint is exhausted.
+type bybitTransport struct {
+	ctx *model.ScrapeCtx
+
+	UnderlyingTransport http.RoundTripper
+}
+
+// RoundTrip implement http roundtrip
+func (t *bybitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.ctx.ReserveWeight(req.Context(), 1); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.UnderlyingTransport.RoundTrip(req)
+	if resp == nil || resp.Header == nil {
+		return resp, err
+	}
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-Bapi-Limit-Status")); err == nil && remaining <= 0 {
+		t.ctx.Weight.Backoff(bybitLimitReset(resp.Header))
+	}
+
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		t.ctx.Weight.Backoff(retryAfter(resp.Header))
+	}
+
+	if err := serverError(resp); err != nil {
+		return nil, err
+	}
+
+	return resp, err
+}
+
+// bybitLimitReset returns the time left until the rate limit of the
+// endpoint is reset.
+func bybitLimitReset(header http.Header) time.Duration {
+	reset, err := strconv.ParseInt(header.Get("X-Bapi-Limit-Reset-Timestamp"), 10, 64)
+	if err != nil {
+		return time.Second
+	}
+
+	return time.Until(time.UnixMilli(reset))
+}
+
+func init() {
+	Register(Definition{
+		Name:        "bybit-linear",
+		Description: "Bybit USDT perpetuals, unified account",
+		New:         NewBybitLinear,
+		WeightLimit: bybitWeightLimit,
+		Capabilities: []Capability{
+			CapabilityPrices,
+			CapabilityBalance,
+			CapabilityAccount,
+			CapabilityPositions,
+			CapabilityOrders,
+			CapabilityIncome,
+			CapabilityTrades,
+			CapabilityTransfers,
+			CapabilityCandles,
+			CapabilitySymbols,
+			CapabilityFunding,
+		},
+	})
+}
+
+func NewBybitLinear(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx) (Exchange, error) {
+	return newBybitLinear(ctx, portfolio, scrapeCtx, bybitBaseURL, http.DefaultTransport)
+}
+
+// newBybitLinear creates the exchange against the api at baseURL, so it
+// can be pointed at a fake server.
+func newBybitLinear(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx, baseURL string, transport http.RoundTripper) (*bybitLinear, error) {
+	exchange := &bybitLinear{
+		portfolio: portfolio,
+		ctx:       scrapeCtx,
+		baseURL:   baseURL,
+		client: &http.Client{Transport: &bybitTransport{
+			ctx:                 scrapeCtx,
+			UnderlyingTransport: transport,
+		}},
+	}
+
+	if err := exchange.get(ctx, "/v5/market/time", url.Values{}, false, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping bybit api: %v", err)
+	}
+
+	return exchange, nil
+}
+
+type bybitTicker struct {
+	Symbol    string `json:"symbol"`
+	LastPrice string `json:"lastPrice"`
+}
+
+func (e *bybitLinear) GetSymbolPrices(ctx context.Context) ([]*model.SymbolPrice, error) {
+	var page struct {
+		List []*bybitTicker `json:"list"`
+	}
+
+	params := url.Values{"category": {bybitCategory}}
+	if err := e.get(ctx, "/v5/market/tickers", params, false, &page); err != nil {
+		return nil, err
+	}
+
+	var prices []*model.SymbolPrice
+	for _, ticker := range page.List {
+		price, err := bybitFloat(ticker.LastPrice)
+		if err != nil {
+			return nil, err
+		}
+
+		prices = append(prices, &model.SymbolPrice{Symbol: ticker.Symbol, Price: price})
+	}
+
+	return prices, nil
+}
+
+func (e *bybitLinear) GetBalance(ctx context.Context) (map[string]float64, error) {
+	var page struct {
+		List []struct {
+			TotalWalletBalance string `json:"totalWalletBalance"`
+		} `json:"list"`
+	}
+
+	params := url.Values{"accountType": {bybitAccountType}}
+	if err := e.get(ctx, "/v5/account/wallet-balance", params, true, &page); err != nil {
+		return nil, err
+	}
+
+	if len(page.List) == 0 {
+		return nil, fmt.Errorf("no %s wallet found", bybitAccountType)
+	}
+
+	balance, err := bybitFloat(page.List[0].TotalWalletBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]float64{bybitSettleCoin: balance}, nil
+}
+
+// GetAccount returns the margin state of the unified account, whose
+// figures bybit values in USD.
+func (e *bybitLinear) GetAccount(ctx context.Context) (*model.AccountSnapshot, error) {
+	var page struct {
+		List []struct {
+			TotalWalletBalance     string `json:"totalWalletBalance"`
+			TotalPerpUPL           string `json:"totalPerpUPL"`
+			TotalMarginBalance     string `json:"totalMarginBalance"`
+			TotalAvailableBalance  string `json:"totalAvailableBalance"`
+			TotalInitialMargin     string `json:"totalInitialMargin"`
+			TotalMaintenanceMargin string `json:"totalMaintenanceMargin"`
+			Coin                   []struct {
+				Coin                string `json:"coin"`
+				WalletBalance       string `json:"walletBalance"`
+				UnrealisedPnl       string `json:"unrealisedPnl"`
+				Equity              string `json:"equity"`
+				AvailableToWithdraw string `json:"availableToWithdraw"`
+				TotalPositionIM     string `json:"totalPositionIM"`
+				TotalPositionMM     string `json:"totalPositionMM"`
+			} `json:"coin"`
+		} `json:"list"`
+	}
+
+	params := url.Values{"accountType": {bybitAccountType}}
+	if err := e.get(ctx, "/v5/account/wallet-balance", params, true, &page); err != nil {
+		return nil, err
+	}
+
+	if len(page.List) == 0 {
+		return nil, fmt.Errorf("no %s wallet found", bybitAccountType)
+	}
+
+	account := page.List[0]
+	snapshot, err := accountFigures{
+		Asset:            "USD",
+		WalletBalance:    account.TotalWalletBalance,
+		UnrealizedPnl:    account.TotalPerpUPL,
+		MarginBalance:    account.TotalMarginBalance,
+		AvailableBalance: account.TotalAvailableBalance,
+		InitialMargin:    account.TotalInitialMargin,
+		MaintMargin:      account.TotalMaintenanceMargin,
+	}.toAccountSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, coin := range account.Coin {
+		balance, err := accountFigures{
+			Asset:            coin.Coin,
+			WalletBalance:    coin.WalletBalance,
+			UnrealizedPnl:    coin.UnrealisedPnl,
+			MarginBalance:    coin.Equity,
+			AvailableBalance: coin.AvailableToWithdraw,
+			InitialMargin:    coin.TotalPositionIM,
+			MaintMargin:      coin.TotalPositionMM,
+		}.toAssetBalance()
+		if err != nil {
+			return nil, err
+		}
+
+		if !balance.IsEmpty() {
+			snapshot.Assets = append(snapshot.Assets, balance)
+		}
+	}
+
+	return snapshot, nil
+}
+
+type bybitPosition struct {
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	Size          string `json:"size"`
+	AvgPrice      string `json:"avgPrice"`
+	PositionIM    string `json:"positionIM"`
+	UnrealisedPnl string `json:"unrealisedPnl"`
+	Leverage      string `json:"leverage"`
+	TradeMode     int    `json:"tradeMode"`
+	PositionIdx   int    `json:"positionIdx"`
+	UpdatedTime   string `json:"updatedTime"`
+}
+
+func (e *bybitLinear) GetPositions(ctx context.Context) ([]*model.Position, error) {
+	params := url.Values{
+		"category":   {bybitCategory},
+		"settleCoin": {bybitSettleCoin},
+		"limit":      {"200"},
+	}
+
+	var positions []*model.Position
+	err := e.getList(ctx, "/v5/position/list", params, func(list json.RawMessage) error {
+		var rawPositions []*bybitPosition
+		if err := json.Unmarshal(list, &rawPositions); err != nil {
+			return err
+		}
+
+		for _, rawPosition := range rawPositions {
+			position, err := e.parsePosition(rawPosition)
+			if err != nil {
+				return err
+			}
+
+			if position.IsOpen() {
+				positions = append(positions, position)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+type bybitOrder struct {
+	OrderID     string `json:"orderId"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	OrderType   string `json:"orderType"`
+	OrderStatus string `json:"orderStatus"`
+	TimeInForce string `json:"timeInForce"`
+	Price       string `json:"price"`
+	AvgPrice    string `json:"avgPrice"`
+	Qty         string `json:"qty"`
+	CumExecQty  string `json:"cumExecQty"`
+	PositionIdx int    `json:"positionIdx"`
+	ReduceOnly  bool   `json:"reduceOnly"`
+	CreatedTime string `json:"createdTime"`
+	UpdatedTime string `json:"updatedTime"`
+}
+
+func (e *bybitLinear) GetOrders(ctx context.Context) ([]*model.Order, error) {
+	params := url.Values{
+		"category":   {bybitCategory},
+		"settleCoin": {bybitSettleCoin},
+		"limit":      {"50"},
+	}
+
+	return e.getOrders(ctx, "/v5/order/realtime", params)
+}
+
+// GetOrder looks the order up among recent orders first, and in the order
+// history if it is no longer there.
+func (e *bybitLinear) GetOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
+	for _, path := range []string{"/v5/order/realtime", "/v5/order/history"} {
+		params := url.Values{
+			"category": {bybitCategory},
+			"symbol":   {order.Symbol},
+			"orderId":  {order.ExternalID},
+		}
+
+		orders, err := e.getOrders(ctx, path, params)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(orders) > 0 {
+			return orders[0], nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (e *bybitLinear) GetOrdersBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Order, error) {
+	if oldest := time.Now().Add(-bybitHistoryRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	var orders []*model.Order
+	err := bybitPaginate(startTime, endTime, func(start, end int64) error {
+		params := url.Values{
+			"category":  {bybitCategory},
+			"symbol":    {symbol},
+			"startTime": {strconv.FormatInt(start, 10)},
+			"endTime":   {strconv.FormatInt(end, 10)},
+			"limit":     {"50"},
+		}
+
+		page, err := e.getOrders(ctx, "/v5/order/history", params)
+		if err != nil {
+			return err
+		}
+
+		orders = append(orders, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (e *bybitLinear) getOrders(ctx context.Context, path string, params url.Values) ([]*model.Order, error) {
+	var orders []*model.Order
+	err := e.getList(ctx, path, params, func(list json.RawMessage) error {
+		var rawOrders []*bybitOrder
+		if err := json.Unmarshal(list, &rawOrders); err != nil {
+			return err
+		}
+
+		for _, rawOrder := range rawOrders {
+			order, err := e.parseOrder(rawOrder)
+			if err != nil {
+				return err
+			}
+
+			orders = append(orders, order)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+type bybitClosedPnl struct {
+	OrderID     string `json:"orderId"`
+	Symbol      string `json:"symbol"`
+	ClosedPnl   string `json:"closedPnl"`
+	UpdatedTime string `json:"updatedTime"`
+}
+
+type bybitTransaction struct {
+	ID              string `json:"id"`
+	Symbol          string `json:"symbol"`
+	Currency        string `json:"currency"`
+	Change          string `json:"change"`
+	TransactionTime string `json:"transactionTime"`
+}
+
+func (e *bybitLinear) GetIncome(ctx context.Context) ([]*model.Income, error) {
+	now := time.Now()
+	return e.GetIncomeBetween(ctx, now.Add(-bybitHistoryWindow).UnixMilli(), now.UnixMilli())
+}
+
+// GetIncomeBetween returns closed position pnl and funding settlements
+// between startTime and endTime, oldest first.
+func (e *bybitLinear) GetIncomeBetween(ctx context.Context, startTime, endTime int64) ([]*model.Income, error) {
+	if endTime <= 0 {
+		endTime = time.Now().UnixMilli()
+	}
+
+	if oldest := time.Now().Add(-bybitHistoryRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	var incomes []*model.Income
+	err := bybitPaginate(startTime, endTime, func(start, end int64) error {
+		pnl, err := e.getClosedPnl(ctx, start, end)
+		if err != nil {
+			return err
+		}
+
+		funding, err := e.getFunding(ctx, start, end)
+		if err != nil {
+			return err
+		}
+
+		incomes = append(incomes, pnl...)
+		incomes = append(incomes, funding...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(incomes, func(i, j int) bool {
+		return incomes[i].Date.Before(incomes[j].Date)
+	})
+
+	return incomes, nil
+}
+
+func (e *bybitLinear) getClosedPnl(ctx context.Context, startTime, endTime int64) ([]*model.Income, error) {
+	params := url.Values{
+		"category":  {bybitCategory},
+		"startTime": {strconv.FormatInt(startTime, 10)},
+		"endTime":   {strconv.FormatInt(endTime, 10)},
+		"limit":     {"100"},
+	}
+
+	var incomes []*model.Income
+	err := e.getList(ctx, "/v5/position/closed-pnl", params, func(list json.RawMessage) error {
+		var records []*bybitClosedPnl
+		if err := json.Unmarshal(list, &records); err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			pnl, err := bybitFloat(record.ClosedPnl)
+			if err != nil {
+				return err
+			}
+
+			date, err := bybitTime(record.UpdatedTime)
+			if err != nil {
+				return err
+			}
+
+			incomes = append(incomes, &model.Income{
+				ID:      hashID(record.OrderID),
+				Type:    "REALIZED_PNL",
+				Symbol:  record.Symbol,
+				Asset:   bybitSettleCoin,
+				Income:  pnl,
+				TradeID: -1,
+				Date:    date,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return incomes, nil
+}
+
+func (e *bybitLinear) getFunding(ctx context.Context, startTime, endTime int64) ([]*model.Income, error) {
+	records, err := e.getTransactionLog(ctx, bybitCategory, "SETTLEMENT", startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	var incomes []*model.Income
+	for _, record := range records {
+		change, err := bybitFloat(record.Change)
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := bybitTime(record.TransactionTime)
+		if err != nil {
+			return nil, err
+		}
+
+		incomes = append(incomes, &model.Income{
+			ID:      hashID(record.ID),
+			Type:    "FUNDING_FEE",
+			Symbol:  record.Symbol,
+			Asset:   record.Currency,
+			Income:  change,
+			TradeID: -1,
+			Date:    date,
+		})
+	}
+
+	return incomes, nil
+}
+
+// GetTransfersBetween returns transfers in and out of the unified account.
+func (e *bybitLinear) GetTransfersBetween(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	if oldest := time.Now().Add(-bybitHistoryRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	var transfers []*model.Transfer
+	err := bybitPaginate(startTime, endTime, func(start, end int64) error {
+		for _, transferType := range []string{model.TransferIn, model.TransferOut} {
+			records, err := e.getTransactionLog(ctx, "", transferType, start, end)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range records {
+				change, err := bybitFloat(record.Change)
+				if err != nil {
+					return err
+				}
+
+				date, err := bybitTime(record.TransactionTime)
+				if err != nil {
+					return err
+				}
+
+				transfers = append(transfers, &model.Transfer{
+					ExternalID: record.ID,
+					Type:       transferType,
+					Asset:      record.Currency,
+					Amount:     change,
+					Date:       date,
+				})
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// getTransactionLog returns the records of the type in the transaction log
+// of the unified account, limited to the category unless it is empty.
+func (e *bybitLinear) getTransactionLog(ctx context.Context, category, transactionType string, startTime, endTime int64) ([]*bybitTransaction, error) {
+	params := url.Values{
+		"accountType": {bybitAccountType},
+		"type":        {transactionType},
+		"startTime":   {strconv.FormatInt(startTime, 10)},
+		"endTime":     {strconv.FormatInt(endTime, 10)},
+		"limit":       {"50"},
+	}
+
+	if category != "" {
+		params.Set("category", category)
+	}
+
+	var records []*bybitTransaction
+	err := e.getList(ctx, "/v5/account/transaction-log", params, func(list json.RawMessage) error {
+		var page []*bybitTransaction
+		if err := json.Unmarshal(list, &page); err != nil {
+			return err
+		}
+
+		records = append(records, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+type bybitExecution struct {
+	ExecID    string `json:"execId"`
+	OrderID   string `json:"orderId"`
+	Symbol    string `json:"symbol"`
+	Side      string `json:"side"`
+	ExecType  string `json:"execType"`
+	ExecPrice string `json:"execPrice"`
+	ExecQty   string `json:"execQty"`
+	ExecValue string `json:"execValue"`
+	ExecFee   string `json:"execFee"`
+	ExecTime  string `json:"execTime"`
+	IsMaker   bool   `json:"isMaker"`
+}
+
+func (e *bybitLinear) GetTrades(ctx context.Context, symbol string) ([]*model.Trade, error) {
+	now := time.Now()
+	return e.GetTradesBetween(ctx, symbol, now.Add(-bybitHistoryWindow).UnixMilli(), now.UnixMilli())
+}
+
+func (e *bybitLinear) GetTradesBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Trade, error) {
+	if oldest := time.Now().Add(-bybitHistoryRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	var trades []*model.Trade
+	err := bybitPaginate(startTime, endTime, func(start, end int64) error {
+		params := url.Values{
+			"category":  {bybitCategory},
+			"symbol":    {symbol},
+			"execType":  {"Trade"},
+			"startTime": {strconv.FormatInt(start, 10)},
+			"endTime":   {strconv.FormatInt(end, 10)},
+			"limit":     {"100"},
+		}
+
+		return e.getList(ctx, "/v5/execution/list", params, func(list json.RawMessage) error {
+			var executions []*bybitExecution
+			if err := json.Unmarshal(list, &executions); err != nil {
+				return err
+			}
+
+			for _, execution := range executions {
+				trade, err := e.parseTrade(execution)
+				if err != nil {
+					return err
+				}
+
+				trades = append(trades, trade)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+func (e *bybitLinear) GetCandles(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]*model.Candle, error) {
+	bybitInterval, ok := bybitKlineIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("unsupported candle interval: %s", interval)
+	}
+
+	return firstCandlePage(interval, bybitKlineLimit, startTime, endTime, func(start, end int64) ([]*model.Candle, error) {
+		var page struct {
+			// klines are [startTime, open, high, low, close, volume, turnover]
+			List [][]string `json:"list"`
+		}
+
+		params := url.Values{
+			"category": {bybitCategory},
+			"symbol":   {symbol},
+			"interval": {bybitInterval},
+			"start":    {strconv.FormatInt(start, 10)},
+			"end":      {strconv.FormatInt(end, 10)},
+			"limit":    {strconv.Itoa(bybitKlineLimit)},
+		}
+		if err := e.get(ctx, "/v5/market/kline", params, false, &page); err != nil {
+			return nil, err
+		}
+
+		var candles []*model.Candle
+		for _, kline := range page.List {
+			candle, err := parseKline(symbol, interval, kline)
+			if err != nil {
+				return nil, err
+			}
+
+			candles = append(candles, candle)
+		}
+
+		return candles, nil
+	})
+}
+
+type bybitInstrument struct {
+	Symbol       string `json:"symbol"`
+	ContractType string `json:"contractType"`
+	Status       string `json:"status"`
+	BaseCoin     string `json:"baseCoin"`
+	QuoteCoin    string `json:"quoteCoin"`
+	SettleCoin   string `json:"settleCoin"`
+	LaunchTime   string `json:"launchTime"`
+	DeliveryTime string `json:"deliveryTime"`
+	PriceFilter  struct {
+		TickSize string `json:"tickSize"`
+	} `json:"priceFilter"`
+	LotSizeFilter struct {
+		QtyStep          string `json:"qtyStep"`
+		MinNotionalValue string `json:"minNotionalValue"`
+	} `json:"lotSizeFilter"`
+}
+
+func (e *bybitLinear) GetSymbolInfos(ctx context.Context) ([]*model.SymbolInfo, error) {
+	var infos []*model.SymbolInfo
+	params := url.Values{"category": {bybitCategory}, "limit": {"1000"}}
+	for {
+		var page struct {
+			List           []*bybitInstrument `json:"list"`
+			NextPageCursor string             `json:"nextPageCursor"`
+		}
+
+		if err := e.get(ctx, "/v5/market/instruments-info", params, false, &page); err != nil {
+			return nil, err
+		}
+
+		for _, instrument := range page.List {
+			info, err := e.parseInstrument(instrument)
+			if err != nil {
+				return nil, err
+			}
+
+			infos = append(infos, info)
+		}
+
+		if page.NextPageCursor == "" {
+			return infos, nil
+		}
+		params.Set("cursor", page.NextPageCursor)
+	}
+}
+
+type bybitFundingRate struct {
+	FundingRate          string `json:"fundingRate"`
+	FundingRateTimestamp string `json:"fundingRateTimestamp"`
+}
+
+func (e *bybitLinear) GetFundingRates(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.FundingRate, error) {
+	var rates []*model.FundingRate
+	window := bybitFundingLimit * time.Hour
+	err := firstWindow(window, startTime, endTime, func(start, end int64) (int, error) {
+		var page struct {
+			List []*bybitFundingRate `json:"list"`
+		}
+
+		params := url.Values{
+			"category":  {bybitCategory},
+			"symbol":    {symbol},
+			"startTime": {strconv.FormatInt(start, 10)},
+			"endTime":   {strconv.FormatInt(end, 10)},
+			"limit":     {strconv.Itoa(bybitFundingLimit)},
+		}
+		if err := e.get(ctx, "/v5/market/funding/history", params, false, &page); err != nil {
+			return 0, err
+		}
+
+		// rates are listed newest first
+		for i := len(page.List) - 1; i >= 0; i-- {
+			rate, err := bybitFloat(page.List[i].FundingRate)
+			if err != nil {
+				return 0, err
+			}
+
+			date, err := bybitTime(page.List[i].FundingRateTimestamp)
+			if err != nil {
+				return 0, err
+			}
+
+			rates = append(rates, &model.FundingRate{Symbol: symbol, Date: date, Rate: rate})
+		}
+
+		return len(page.List), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = fillMarkPrices(rates, func(start, end int64) ([]*model.Candle, error) {
+		return firstCandlePage("1h", bybitKlineLimit, start, end, func(start, end int64) ([]*model.Candle, error) {
+			var page struct {
+				// klines are [startTime, open, high, low, close]
+				List [][]string `json:"list"`
+			}
+
+			params := url.Values{
+				"category": {bybitCategory},
+				"symbol":   {symbol},
+				"interval": {bybitKlineIntervals["1h"]},
+				"start":    {strconv.FormatInt(start, 10)},
+				"end":      {strconv.FormatInt(end, 10)},
+				"limit":    {strconv.Itoa(bybitKlineLimit)},
+			}
+			if err := e.get(ctx, "/v5/market/mark-price-kline", params, false, &page); err != nil {
+				return nil, err
+			}
+
+			var candles []*model.Candle
+			for _, kline := range page.List {
+				candle, err := parseKline(symbol, "1h", kline)
+				if err != nil {
+					return nil, err
+				}
+
+				candles = append(candles, candle)
+			}
+
+			return candles, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+type bybitResponse struct {
+	RetCode int64           `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// get sends a request to the bybit api and decodes its result into result.
+func (e *bybitLinear) get(ctx context.Context, path string, params url.Values, signed bool, result interface{}) error {
+	query := params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.baseURL+path+"?"+query, nil)
+	if err != nil {
+		return err
+	}
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(e.portfolio.APISecret))
+		mac.Write([]byte(timestamp + e.portfolio.APIKey + bybitRecvWindow + query))
+
+		req.Header.Set("X-BAPI-API-KEY", e.portfolio.APIKey)
+		req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+		req.Header.Set("X-BAPI-RECV-WINDOW", bybitRecvWindow)
+		req.Header.Set("X-BAPI-SIGN", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	response := &bybitResponse{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("unexpected response, status %d: %v", resp.StatusCode, err)
+	}
+
+	if response.RetCode != 0 {
+		if response.RetCode == bybitRateLimited {
+			e.ctx.Weight.Backoff(bybitLimitReset(resp.Header))
+		}
+		return &BybitAPIError{Code: response.RetCode, Message: response.RetMsg}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// getList walks the pages of a signed list endpoint, calling each with
+// the raw list of every page.
+func (e *bybitLinear) getList(ctx context.Context, path string, params url.Values, each func(list json.RawMessage) error) error {
+	for {
+		var page struct {
+			List           json.RawMessage `json:"list"`
+			NextPageCursor string          `json:"nextPageCursor"`
+		}
+
+		if err := e.get(ctx, path, params, true, &page); err != nil {
+			return err
+		}
+
+		if len(page.List) > 0 {
+			if err := each(page.List); err != nil {
+				return err
+			}
+		}
+
+		if page.NextPageCursor == "" {
+			return nil
+		}
+		params.Set("cursor", page.NextPageCursor)
+	}
+}
+
+// bybitPaginate walks the time range between startTime and endTime in
+// windows the history endpoints accept.
+func bybitPaginate(startTime, endTime int64, fetch func(start, end int64) error) error {
+	for startTime <= endTime {
+		windowEnd := startTime + bybitHistoryWindow.Milliseconds() - 1
+		if windowEnd > endTime {
+			windowEnd = endTime
+		}
+
+		if err := fetch(startTime, windowEnd); err != nil {
+			return err
+		}
+
+		startTime = windowEnd + 1
+	}
+
+	return nil
+}
+
+func (e *bybitLinear) parsePosition(position *bybitPosition) (*model.Position, error) {
+	amount, err := bybitFloat(position.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	if position.Side == "Sell" {
+		amount = -amount
+	}
+
+	cost, err := bybitFloat(position.PositionIM)
+	if err != nil {
+		return nil, err
+	}
+
+	ePrice, err := bybitFloat(position.AvgPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	unpnl, err := bybitFloat(position.UnrealisedPnl)
+	if err != nil {
+		return nil, err
+	}
+
+	lev, err := bybitFloat(position.Leverage)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := bybitTime(position.UpdatedTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Position{
+		Symbol:     position.Symbol,
+		Amount:     amount,
+		Cost:       cost,
+		EntryPrice: ePrice,
+		Isolated:   position.TradeMode == 1,
+		UnPnl:      unpnl,
+		Side:       bybitPositionSides[position.PositionIdx],
+		Leverage:   int32(lev),
+		Date:       date,
+	}, nil
+}
+
+func (e *bybitLinear) parseOrder(order *bybitOrder) (*model.Order, error) {
+	price, err := bybitFloat(order.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	avgPrice, err := bybitFloat(order.AvgPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := bybitFloat(order.Qty)
+	if err != nil {
+		return nil, err
+	}
+
+	executed, err := bybitFloat(order.CumExecQty)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := bybitTime(order.CreatedTime)
+	if err != nil {
+		return nil, err
+	}
+
+	updateDate, err := bybitTime(order.UpdatedTime)
+	if err != nil {
+		return nil, err
+	}
+
+	status, ok := bybitOrderStatuses[order.OrderStatus]
+	if !ok {
+		status = strings.ToUpper(order.OrderStatus)
+	}
+
+	return &model.Order{
+		ID:             hashID(order.OrderID),
+		ExternalID:     order.OrderID,
+		Symbol:         order.Symbol,
+		Side:           strings.ToUpper(order.Side),
+		PositionSide:   bybitPositionSides[order.PositionIdx],
+		TimeInForce:    strings.ToUpper(order.TimeInForce),
+		Type:           strings.ToUpper(order.OrderType),
+		Status:         status,
+		Price:          price,
+		AvgPrice:       avgPrice,
+		Amount:         amount,
+		ExecutedAmount: executed,
+		ReduceOnly:     order.ReduceOnly,
+		Date:           date,
+		UpdateDate:     updateDate,
+	}, nil
+}
+
+func (e *bybitLinear) parseInstrument(instrument *bybitInstrument) (*model.SymbolInfo, error) {
+	info := &model.SymbolInfo{
+		Symbol:       instrument.Symbol,
+		BaseAsset:    instrument.BaseCoin,
+		QuoteAsset:   instrument.QuoteCoin,
+		MarginAsset:  instrument.SettleCoin,
+		ContractType: bybitContractTypes[instrument.ContractType],
+		Status:       bybitSymbolStatuses[instrument.Status],
+	}
+
+	if info.ContractType == "" {
+		info.ContractType = instrument.ContractType
+	}
+
+	if info.Status == "" {
+		info.Status = model.SymbolStatusHalted
+	}
+
+	var err error
+	if info.TickSize, err = bybitFloat(instrument.PriceFilter.TickSize); err != nil {
+		return nil, err
+	}
+
+	if info.LotSize, err = bybitFloat(instrument.LotSizeFilter.QtyStep); err != nil {
+		return nil, err
+	}
+
+	if info.MinNotional, err = bybitFloat(instrument.LotSizeFilter.MinNotionalValue); err != nil {
+		return nil, err
+	}
+
+	if info.ListDate, err = bybitTime(instrument.LaunchTime); err != nil {
+		return nil, err
+	}
+
+	// perpetuals are given a delivery time once they are to be delisted
+	if instrument.DeliveryTime != "0" {
+		if info.DelistDate, err = bybitTime(instrument.DeliveryTime); err != nil {
+			return nil, err
+		}
+
+		if info.ContractType == "PERPETUAL" && info.Status == model.SymbolStatusTrading {
+			info.Status = model.SymbolStatusDelisting
+		}
+	}
+
+	return info, nil
+}
+
+func (e *bybitLinear) parseTrade(execution *bybitExecution) (*model.Trade, error) {
+	price, err := bybitFloat(execution.ExecPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := bybitFloat(execution.ExecQty)
+	if err != nil {
+		return nil, err
+	}
+
+	quoteAmount, err := bybitFloat(execution.ExecValue)
+	if err != nil {
+		return nil, err
+	}
+
+	commission, err := bybitFloat(execution.ExecFee)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := bybitTime(execution.ExecTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Trade{
+		ID:              hashID(execution.ExecID),
+		Symbol:          execution.Symbol,
+		OrderID:         hashID(execution.OrderID),
+		Side:            strings.ToUpper(execution.Side),
+		Price:           price,
+		Amount:          amount,
+		QuoteAmount:     quoteAmount,
+		Commission:      commission,
+		CommissionAsset: bybitSettleCoin,
+		Buyer:           execution.Side == "Buy",
+		Maker:           execution.IsMaker,
+		Date:            date,
+	}, nil
+}
+
+// bybitFloat parses a bybit decimal, which is empty when it has no value.
+func bybitFloat(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+func bybitTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.UnixMilli(ms), nil
+}
+
+// hashID maps an exchange id that is not numeric onto a positive int64,
+// so it fits the numeric ids of the model.
+func hashID(id string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+
+	return int64(h.Sum64() >> 1)
+}
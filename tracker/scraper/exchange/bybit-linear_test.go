@@ -0,0 +1,249 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+const (
+	testBybitKey    = "test-key"
+	testBybitSecret = "test-secret"
+)
+
+// newTestBybit creates the exchange against a fake server serving the
+// handlers by path. The server time endpoint, which the exchange pings
+// when it is created, is served unless a handler is given for it.
+func newTestBybit(t *testing.T, handlers map[string]http.HandlerFunc) *bybitLinear {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	if _, ok := handlers["/v5/market/time"]; !ok {
+		mux.HandleFunc("/v5/market/time", func(w http.ResponseWriter, r *http.Request) {
+			writeBybitResult(w, `{}`)
+		})
+	}
+	for path, handler := range handlers {
+		mux.HandleFunc(path, handler)
+	}
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	portfolio := &model.Portfolio{ID: "test", Exchange: "bybit-linear", APIKey: testBybitKey, APISecret: testBybitSecret}
+	scrapeCtx := &model.ScrapeCtx{Portfolio: portfolio, PortfolioID: portfolio.ID, Weight: NewWeightBudget(1000)}
+
+	e, err := newBybitLinear(context.Background(), portfolio, scrapeCtx, server.URL, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func writeBybitResult(w http.ResponseWriter, result string) {
+	fmt.Fprintf(w, `{"retCode":0,"retMsg":"OK","result":%s}`, result)
+}
+
+// checkBybitSignature fails the request unless it is signed the way bybit
+// checks it.
+func checkBybitSignature(t *testing.T, r *http.Request) bool {
+	t.Helper()
+
+	if got := r.Header.Get("X-BAPI-API-KEY"); got != testBybitKey {
+		t.Errorf("api key = %q, want %q", got, testBybitKey)
+		return false
+	}
+
+	timestamp := r.Header.Get("X-BAPI-TIMESTAMP")
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Errorf("timestamp %q: %v", timestamp, err)
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(testBybitSecret))
+	mac.Write([]byte(timestamp + testBybitKey + r.Header.Get("X-BAPI-RECV-WINDOW") + r.URL.RawQuery))
+	if want := hex.EncodeToString(mac.Sum(nil)); r.Header.Get("X-BAPI-SIGN") != want {
+		t.Errorf("signature = %q, want %q", r.Header.Get("X-BAPI-SIGN"), want)
+		return false
+	}
+
+	return true
+}
+
+func TestBybitSigning(t *testing.T) {
+	e := newTestBybit(t, map[string]http.HandlerFunc{
+		"/v5/market/tickers": func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-BAPI-SIGN") != "" {
+				t.Error("public request is signed")
+			}
+			writeBybitResult(w, `{"list":[{"symbol":"BTCUSDT","lastPrice":"30000.5"}]}`)
+		},
+		"/v5/account/wallet-balance": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("accountType") != bybitAccountType {
+				t.Errorf("accountType = %q", r.URL.Query().Get("accountType"))
+			}
+			if !checkBybitSignature(t, r) {
+				fmt.Fprint(w, `{"retCode":10004,"retMsg":"error sign!"}`)
+				return
+			}
+			writeBybitResult(w, `{"list":[{"totalWalletBalance":"1234.5"}]}`)
+		},
+	})
+
+	prices, err := e.GetSymbolPrices(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 1 || prices[0].Symbol != "BTCUSDT" || prices[0].Price != 30000.5 {
+		t.Errorf("prices = %+v", prices)
+	}
+
+	balances, err := e.GetBalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balances[bybitSettleCoin] != 1234.5 {
+		t.Errorf("balances = %v", balances)
+	}
+}
+
+func TestBybitCursorPagination(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"list":[{"symbol":"BTCUSDT","side":"Buy","size":"0.5","positionIdx":1,"updatedTime":"1700000000000"}],"nextPageCursor":"p2"}`,
+		"p2": `{"list":[{"symbol":"ETHUSDT","side":"Sell","size":"2","positionIdx":2,"updatedTime":"1700000000000"}],"nextPageCursor":""}`,
+	}
+
+	var cursors []string
+	e := newTestBybit(t, map[string]http.HandlerFunc{
+		"/v5/position/list": func(w http.ResponseWriter, r *http.Request) {
+			checkBybitSignature(t, r)
+
+			cursor := r.URL.Query().Get("cursor")
+			cursors = append(cursors, cursor)
+			writeBybitResult(w, pages[cursor])
+		},
+	})
+
+	positions, err := e.GetPositions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(cursors) != "[ p2]" {
+		t.Errorf("cursors = %q, want the first page and p2", cursors)
+	}
+
+	if len(positions) != 2 {
+		t.Fatalf("got %d positions, want 2", len(positions))
+	}
+	if positions[0].Symbol != "BTCUSDT" || positions[0].Amount != 0.5 || positions[0].Side != "LONG" {
+		t.Errorf("first position = %+v", positions[0])
+	}
+	if positions[1].Symbol != "ETHUSDT" || positions[1].Amount != -2 || positions[1].Side != "SHORT" {
+		t.Errorf("second position = %+v", positions[1])
+	}
+}
+
+func TestBybitOrderHistoryWindows(t *testing.T) {
+	end := time.Now()
+	start := end.Add(-10 * 24 * time.Hour)
+
+	var windows [][2]int64
+	e := newTestBybit(t, map[string]http.HandlerFunc{
+		"/v5/order/history": func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			windowStart, _ := strconv.ParseInt(query.Get("startTime"), 10, 64)
+			windowEnd, _ := strconv.ParseInt(query.Get("endTime"), 10, 64)
+
+			if query.Get("cursor") == "" {
+				windows = append(windows, [2]int64{windowStart, windowEnd})
+				writeBybitResult(w, fmt.Sprintf(`{"list":[{"orderId":"a-%d","symbol":"BTCUSDT","orderStatus":"Filled","createdTime":"%d"}],"nextPageCursor":"next"}`, windowStart, windowStart))
+				return
+			}
+
+			writeBybitResult(w, fmt.Sprintf(`{"list":[{"orderId":"b-%d","symbol":"BTCUSDT","orderStatus":"Cancelled","createdTime":"%d"}],"nextPageCursor":""}`, windowStart, windowStart))
+		},
+	})
+
+	orders, err := e.GetOrdersBetween(context.Background(), "BTCUSDT", start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(windows) != 2 {
+		t.Fatalf("queried %d windows, want 2", len(windows))
+	}
+	if windows[0][0] != start.UnixMilli() || windows[1][1] != end.UnixMilli() || windows[1][0] != windows[0][1]+1 {
+		t.Errorf("windows = %v, want %d to %d without gaps", windows, start.UnixMilli(), end.UnixMilli())
+	}
+	if span := time.Duration(windows[0][1]-windows[0][0]+1) * time.Millisecond; span > bybitHistoryWindow {
+		t.Errorf("window spans %v, longer than %v", span, bybitHistoryWindow)
+	}
+
+	if len(orders) != 4 {
+		t.Fatalf("got %d orders, want both pages of both windows", len(orders))
+	}
+	if orders[0].ExternalID != fmt.Sprintf("a-%d", start.UnixMilli()) || orders[0].ID != hashID(orders[0].ExternalID) {
+		t.Errorf("first order = %+v", orders[0])
+	}
+	if orders[1].Status != model.OrderStatusCanceled {
+		t.Errorf("second order status = %q, want %q", orders[1].Status, model.OrderStatusCanceled)
+	}
+}
+
+func TestBybitErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		code      int64
+		transient bool
+	}{
+		{"invalid key", http.StatusOK, `{"retCode":10003,"retMsg":"API key is invalid."}`, 10003, false},
+		{"timestamp", http.StatusOK, `{"retCode":10002,"retMsg":"invalid request, please check your server timestamp"}`, 10002, true},
+		{"rate limited", http.StatusOK, `{"retCode":10006,"retMsg":"Too many visits!"}`, bybitRateLimited, true},
+		{"server error", http.StatusBadGateway, `bad gateway`, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newTestBybit(t, map[string]http.HandlerFunc{
+				"/v5/account/wallet-balance": func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("X-Bapi-Limit-Reset-Timestamp", strconv.FormatInt(time.Now().UnixMilli(), 10))
+					w.WriteHeader(test.status)
+					fmt.Fprint(w, test.body)
+				},
+			})
+
+			_, err := e.GetBalance(context.Background())
+			if err == nil {
+				t.Fatal("got no error")
+			}
+
+			var apiErr *BybitAPIError
+			if test.code != 0 && (!errors.As(err, &apiErr) || apiErr.Code != test.code) {
+				t.Errorf("error = %v, want bybit error code %d", err, test.code)
+			}
+
+			var serverErr *ServerError
+			if test.code == 0 && (!errors.As(err, &serverErr) || serverErr.StatusCode != test.status) {
+				t.Errorf("error = %v, want server error with status %d", err, test.status)
+			}
+
+			if IsTransient(err) != test.transient {
+				t.Errorf("IsTransient(%v) = %v, want %v", err, !test.transient, test.transient)
+			}
+		})
+	}
+}
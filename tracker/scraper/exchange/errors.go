@@ -0,0 +1,84 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// ServerError is returned in place of a response with a 5xx status, so
+// exchanges failing to serve a request are told apart the same way for
+// every adapter.
+type ServerError struct {
+	StatusCode int
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("exchange server error, status %d", e.StatusCode)
+}
+
+func (e *ServerError) Transient() bool {
+	return true
+}
+
+// serverError closes a response with a 5xx status and returns it as a
+// ServerError, and returns nil for any other response.
+func serverError(resp *http.Response) error {
+	if resp.StatusCode < http.StatusInternalServerError {
+		return nil
+	}
+
+	resp.Body.Close()
+	return &ServerError{StatusCode: resp.StatusCode}
+}
+
+// IsTransient reports whether a request failed for a reason a retry may
+// not run into again: a timeout, a dropped connection, a 5xx response,
+// or an error code the exchange documents as temporary, such as a
+// timestamp outside of the receive window.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var transient interface{ Transient() bool }
+	if errors.As(err, &transient) {
+		return transient.Transient()
+	}
+
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) {
+		return binanceTransientCodes[apiErr.Code]
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// IsAuthFailure reports whether a request was refused for the API key it
+// was made with: an invalid or expired key, a bad signature or missing
+// permissions. Unlike transient failures, these persist until the key is
+// fixed.
+func IsAuthFailure(err error) bool {
+	var auth interface{ Auth() bool }
+	if errors.As(err, &auth) {
+		return auth.Auth()
+	}
+
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) {
+		return binanceAuthCodes[apiErr.Code]
+	}
+
+	return false
+}
@@ -1,25 +1,355 @@
 package exchange
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
 )
 
+// Exchange is the least an exchange adapter implements. Anything else it
+// can scrape is offered through the optional capability interfaces below,
+// and scrape tasks an adapter does not implement are skipped.
 type Exchange interface {
-	GetSymbolPrices() ([]*model.SymbolPrice, error)
-	GetBalance() (float64, error)
-	GetPositions() ([]*model.Position, error)
-	GetOrders() ([]*model.Order, error)
-	GetIncome() ([]*model.Income, error)
-	GetIncomeBetween(start, end int64) ([]*model.Income, error)
-}
-
-func NewExchange(portfolio *model.Portfolio, ctx *model.ScrapeCtx) (Exchange, error) {
-	switch portfolio.Exchange {
-	case "binance-futures":
-		return NewBinanceFutures(portfolio, ctx)
-	default:
+	// GetBalance returns wallet balances by margin asset.
+	GetBalance(ctx context.Context) (map[string]float64, error)
+}
+
+type PriceReader interface {
+	GetSymbolPrices(ctx context.Context) ([]*model.SymbolPrice, error)
+}
+
+// AccountReader is implemented by exchanges that report the margin state
+// of the account and of each of its assets, beyond wallet balances.
+type AccountReader interface {
+	GetAccount(ctx context.Context) (*model.AccountSnapshot, error)
+}
+
+// UserDataStreamer is implemented by exchanges that push changes to the
+// account as they happen. StreamUserData connects to the user data stream
+// and calls handle with every change, until the connection drops, handle
+// fails or ctx is done. It calls connected once subscribed, so state read
+// from then on misses no changes.
+type UserDataStreamer interface {
+	StreamUserData(ctx context.Context, connected func() error, handle func(*UserDataEvent) error) error
+}
+
+// UserDataEvent is a change pushed by a user data stream. Only what the
+// change is about is set.
+type UserDataEvent struct {
+	// Balances holds wallet balances by margin asset, like GetBalance.
+	Balances map[string]float64
+	// Positions holds the positions that changed, closed ones with an
+	// amount of 0.
+	Positions []*model.Position
+	Order     *model.Order
+	Date      time.Time
+}
+
+type PositionReader interface {
+	GetPositions(ctx context.Context) ([]*model.Position, error)
+}
+
+type OrderReader interface {
+	GetOrders(ctx context.Context) ([]*model.Order, error)
+	GetOrder(ctx context.Context, order *model.Order) (*model.Order, error)
+	GetOrdersBetween(ctx context.Context, symbol string, start, end int64) ([]*model.Order, error)
+}
+
+type IncomeReader interface {
+	GetIncome(ctx context.Context) ([]*model.Income, error)
+	GetIncomeBetween(ctx context.Context, start, end int64) ([]*model.Income, error)
+}
+
+type TradeReader interface {
+	GetTrades(ctx context.Context, symbol string) ([]*model.Trade, error)
+	GetTradesBetween(ctx context.Context, symbol string, start, end int64) ([]*model.Trade, error)
+}
+
+// TransferReader is implemented by exchanges that can list deposits,
+// withdrawals and transfers in and out of the account.
+type TransferReader interface {
+	GetTransfersBetween(ctx context.Context, start, end int64) ([]*model.Transfer, error)
+}
+
+// SymbolInfoReader is implemented by exchanges that publish the trading
+// rules and listing status of their symbols.
+type SymbolInfoReader interface {
+	GetSymbolInfos(ctx context.Context) ([]*model.SymbolInfo, error)
+}
+
+// FundingReader is implemented by exchanges that publish the funding rate
+// history of their perpetual symbols. GetFundingRates returns a page of the
+// rates of the symbol for funding times between start and end, oldest
+// first, with the mark price at their funding time.
+type FundingReader interface {
+	GetFundingRates(ctx context.Context, symbol string, start, end int64) ([]*model.FundingRate, error)
+}
+
+// CandleReader is implemented by exchanges that serve candles of their
+// symbols. GetCandles returns a page of candles of the interval, one of
+// model.CandleIntervals, that open between start and end, oldest first.
+type CandleReader interface {
+	GetCandles(ctx context.Context, symbol, interval string, start, end int64) ([]*model.Candle, error)
+}
+
+// firstWindow walks the time range between startTime and endTime in
+// windows, until fetch returns a window with records. It serves endpoints
+// that return the newest records of a range first, with windows no longer
+// than a page.
+func firstWindow(window time.Duration, startTime, endTime int64, fetch func(start, end int64) (int, error)) error {
+	for startTime <= endTime {
+		windowEnd := startTime + window.Milliseconds() - 1
+		if windowEnd > endTime {
+			windowEnd = endTime
+		}
+
+		n, err := fetch(startTime, windowEnd)
+		if err != nil || n > 0 {
+			return err
+		}
+
+		startTime = windowEnd + 1
+	}
+
+	return nil
+}
+
+// firstCandlePage returns the candles of the interval in the first window
+// of limit candles between startTime and endTime that has any, oldest
+// first.
+func firstCandlePage(interval string, limit int, startTime, endTime int64, fetch func(start, end int64) ([]*model.Candle, error)) ([]*model.Candle, error) {
+	window := model.CandleIntervals[interval] * time.Duration(limit)
+	if window <= 0 {
+		return nil, fmt.Errorf("unsupported candle interval: %s", interval)
+	}
+
+	var candles []*model.Candle
+	err := firstWindow(window, startTime, endTime, func(start, end int64) (int, error) {
+		var err error
+		candles, err = fetch(start, end)
+		return len(candles), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].OpenTime.Before(candles[j].OpenTime)
+	})
+
+	return candles, nil
+}
+
+// fillMarkPrices sets the mark price of funding rates the exchange did not
+// publish one for to the open of the hourly mark price candle their funding
+// time falls in. fetch returns a page of those candles, oldest first.
+func fillMarkPrices(rates []*model.FundingRate, fetch func(start, end int64) ([]*model.Candle, error)) error {
+	var missing []*model.FundingRate
+	for _, rate := range rates {
+		if rate.MarkPrice == 0 {
+			missing = append(missing, rate)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	opens := map[int64]float64{}
+	start := missing[0].Date.Truncate(time.Hour).UnixMilli()
+	end := missing[len(missing)-1].Date.UnixMilli()
+	for start <= end {
+		candles, err := fetch(start, end)
+		if err != nil {
+			return err
+		}
+
+		if len(candles) == 0 {
+			break
+		}
+
+		for _, candle := range candles {
+			opens[candle.OpenTime.UnixMilli()] = candle.Open
+		}
+
+		next := candles[len(candles)-1].OpenTime.Add(time.Hour).UnixMilli()
+		if next <= start {
+			break
+		}
+		start = next
+	}
+
+	for _, rate := range missing {
+		rate.MarkPrice = opens[rate.Date.Truncate(time.Hour).UnixMilli()]
+	}
+
+	return nil
+}
+
+// accountFigures are the balance figures of an account or one of its
+// assets, as the exchange sends them. Empty figures are parsed as 0.
+type accountFigures struct {
+	Asset            string
+	WalletBalance    string
+	UnrealizedPnl    string
+	MarginBalance    string
+	AvailableBalance string
+	InitialMargin    string
+	MaintMargin      string
+}
+
+func (f accountFigures) parse() ([6]float64, error) {
+	var values [6]float64
+	figures := []string{f.WalletBalance, f.UnrealizedPnl, f.MarginBalance, f.AvailableBalance, f.InitialMargin, f.MaintMargin}
+	for i, figure := range figures {
+		if figure == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(figure, 64)
+		if err != nil {
+			return values, fmt.Errorf("%s balance: %v", f.Asset, err)
+		}
+
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+func (f accountFigures) toAccountSnapshot() (*model.AccountSnapshot, error) {
+	values, err := f.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AccountSnapshot{
+		Asset:            f.Asset,
+		WalletBalance:    values[0],
+		UnrealizedPnl:    values[1],
+		MarginBalance:    values[2],
+		AvailableBalance: values[3],
+		InitialMargin:    values[4],
+		MaintMargin:      values[5],
+	}, nil
+}
+
+func (f accountFigures) toAssetBalance() (*model.AssetBalance, error) {
+	values, err := f.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AssetBalance{
+		Asset:            f.Asset,
+		WalletBalance:    values[0],
+		UnrealizedPnl:    values[1],
+		MarginBalance:    values[2],
+		AvailableBalance: values[3],
+		InitialMargin:    values[4],
+		MaintMargin:      values[5],
+	}, nil
+}
+
+// parseKline parses a kline sent as [open time, open, high, low, close,
+// volume, quote volume]. Price klines, such as mark price ones, end at
+// close and have no volume.
+func parseKline(symbol, interval string, kline []string) (*model.Candle, error) {
+	if len(kline) < 5 {
+		return nil, fmt.Errorf("unexpected kline: %v", kline)
+	}
+
+	openTime, err := strconv.ParseInt(kline[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, 6)
+	for i := 0; i < len(values) && i+1 < len(kline); i++ {
+		if values[i], err = strconv.ParseFloat(kline[i+1], 64); err != nil {
+			return nil, err
+		}
+	}
+
+	return &model.Candle{
+		Symbol:      symbol,
+		Interval:    interval,
+		OpenTime:    time.UnixMilli(openTime),
+		Open:        values[0],
+		High:        values[1],
+		Low:         values[2],
+		Close:       values[3],
+		Volume:      values[4],
+		QuoteVolume: values[5],
+	}, nil
+}
+
+// Implements reports whether the exchange implements the interface of the
+// capability.
+func Implements(e Exchange, capability Capability) bool {
+	var ok bool
+	switch capability {
+	case CapabilityBalance:
+		ok = e != nil
+	case CapabilityAccount:
+		_, ok = e.(AccountReader)
+	case CapabilityUserData:
+		_, ok = e.(UserDataStreamer)
+	case CapabilityPrices:
+		_, ok = e.(PriceReader)
+	case CapabilityPositions:
+		_, ok = e.(PositionReader)
+	case CapabilityOrders:
+		_, ok = e.(OrderReader)
+	case CapabilityIncome:
+		_, ok = e.(IncomeReader)
+	case CapabilityTrades:
+		_, ok = e.(TradeReader)
+	case CapabilityTransfers:
+		_, ok = e.(TransferReader)
+	case CapabilityCandles:
+		_, ok = e.(CandleReader)
+	case CapabilityFunding:
+		_, ok = e.(FundingReader)
+	case CapabilitySymbols:
+		_, ok = e.(SymbolInfoReader)
+	}
+
+	return ok
+}
+
+// SymbolLister is implemented by exchanges that can tell which symbols an
+// account trades without relying on its positions or income.
+type SymbolLister interface {
+	GetAccountSymbols(ctx context.Context) ([]string, error)
+}
+
+// NewExchange creates the exchange adapter registered under the name the
+// portfolio is configured with.
+func NewExchange(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx) (Exchange, error) {
+	def := Lookup(portfolio.Exchange)
+	if def == nil {
 		return nil, fmt.Errorf("unsupported exchange: %s", portfolio.Exchange)
 	}
+
+	if err := def.Validate(portfolio); err != nil {
+		return nil, err
+	}
+
+	exchange, err := def.New(ctx, portfolio, scrapeCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, capability := range def.Capabilities {
+		if !Implements(exchange, capability) {
+			return nil, fmt.Errorf("%s declares %s but does not implement it", def.Name, capability)
+		}
+	}
+
+	return exchange, nil
 }
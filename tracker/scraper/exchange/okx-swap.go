@@ -0,0 +1,1243 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+const (
+	okxBaseURL  = "https://www.okx.com"
+	okxInstType = "SWAP"
+
+	// okxPageLimit is the largest page list endpoints return.
+	okxPageLimit = 100
+	// okxHistoryWindow is the range GetIncome and GetTrades return.
+	okxHistoryWindow = 7 * 24 * time.Hour
+	// okxHistoryRetention is how far back archive endpoints can be queried.
+	okxHistoryRetention = 90 * 24 * time.Hour
+	// okxRateLimitBackoff is how long to wait once a rate limit, which okx
+	// counts in windows of 2 seconds, is exceeded.
+	okxRateLimitBackoff = 2 * time.Second
+
+	// okxCandleLimit is the largest page of history candles, and of
+	// funding rates. Symbols are funded at most hourly, so a page of rates
+	// spans at least as many hours.
+	okxCandleLimit = 100
+
+	okxRateLimited      = "50011"
+	okxOrderNotFound    = "51603"
+	okxBillTypeTransfer = "1"
+	okxBillTypeTrade    = "2"
+	okxTimestampFormat  = "2006-01-02T15:04:05.000Z"
+
+	// okxWeightLimit is the number of requests made per minute, half of the
+	// 10 per 2 seconds okx allows on most private endpoints.
+	okxWeightLimit = 150
+)
+
+// okxTransientCodes are the error codes of requests that may succeed when
+// retried: unavailable or busy services, timeouts, rate limits and
+// expired request timestamps.
+var okxTransientCodes = map[string]bool{
+	"50001":        true,
+	"50004":        true,
+	okxRateLimited: true,
+	"50013":        true,
+	"50026":        true,
+	"50102":        true,
+}
+
+// okxAuthCodes are the error codes of requests refused for the API key:
+// frozen, unknown or invalid keys, invalid signatures and missing
+// permissions.
+var okxAuthCodes = map[string]bool{
+	"50100": true,
+	"50101": true,
+	"50111": true,
+	"50113": true,
+	"50119": true,
+	"50120": true,
+}
+
+var okxInstrumentStates = map[string]string{
+	"preopen": model.SymbolStatusPending,
+	"test":    model.SymbolStatusPending,
+	"live":    model.SymbolStatusTrading,
+	"suspend": model.SymbolStatusHalted,
+}
+
+var okxCandleBars = map[string]string{
+	"1m":  "1m",
+	"5m":  "5m",
+	"15m": "15m",
+	"30m": "30m",
+	"1h":  "1H",
+	"4h":  "4H",
+	"1d":  "1Dutc",
+}
+
+var okxOrderStatuses = map[string]string{
+	"live":             model.OrderStatusNew,
+	"partially_filled": model.OrderStatusPartiallyFilled,
+	"filled":           model.OrderStatusFilled,
+	"canceled":         model.OrderStatusCanceled,
+	"mmp_canceled":     model.OrderStatusCanceled,
+}
+
+// okxOrderTypes maps okx order types onto order type and time in force.
+var okxOrderTypes = map[string][2]string{
+	"market":            {"MARKET", "GTC"},
+	"limit":             {"LIMIT", "GTC"},
+	"post_only":         {"LIMIT", "GTX"},
+	"fok":               {"LIMIT", "FOK"},
+	"ioc":               {"LIMIT", "IOC"},
+	"optimal_limit_ioc": {"MARKET", "IOC"},
+}
+
+var okxPositionSides = map[string]string{
+	"net":   "BOTH",
+	"long":  "LONG",
+	"short": "SHORT",
+}
+
+var okxBillTypes = map[string]string{
+	"1": "TRANSFER",
+	"3": "DELIVERY",
+	"5": "LIQUIDATION",
+	"7": "INTEREST",
+	"8": "FUNDING_FEE",
+	"9": "ADL",
+}
+
+type OKXAPIError struct {
+	Code    string
+	Message string
+}
+
+func (e *OKXAPIError) Error() string {
+	return fmt.Sprintf("<OKXAPIError> code=%s, msg=%s", e.Code, e.Message)
+}
+
+// Transient reports whether the request may succeed when retried.
+func (e *OKXAPIError) Transient() bool {
+	return okxTransientCodes[e.Code]
+}
+
+// Auth reports whether the request was refused for the API key.
+func (e *OKXAPIError) Auth() bool {
+	return okxAuthCodes[e.Code]
+}
+
+type okxSwap struct {
+	portfolio *model.Portfolio
+	ctx       *model.ScrapeCtx
+	client    *http.Client
+	baseURL   string
+
+	contractSizes map[string]float64
+}
+
+// okxTransport reserves request weight before a request is sent, and
+// backs off when okx rejects a request for exceeding the rate limit.
+type okxTransport struct {
+	ctx *model.ScrapeCtx
+
+	UnderlyingTransport http.RoundTripper
+}
+
+// RoundTrip implement http roundtrip
+func (t *okxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.ctx.ReserveWeight(req.Context(), 1); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.UnderlyingTransport.RoundTrip(req)
+	if resp == nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.ctx.Weight.Backoff(okxRateLimitBackoff)
+	}
+
+	if err := serverError(resp); err != nil {
+		return nil, err
+	}
+
+	return resp, err
+}
+
+func init() {
+	Register(Definition{
+		Name:        "okx-swap",
+		Description: "OKX perpetual swaps",
+		New:         NewOKXSwap,
+		WeightLimit: okxWeightLimit,
+		Capabilities: []Capability{
+			CapabilityPrices,
+			CapabilityBalance,
+			CapabilityAccount,
+			CapabilityPositions,
+			CapabilityOrders,
+			CapabilityIncome,
+			CapabilityTrades,
+			CapabilityTransfers,
+			CapabilityCandles,
+			CapabilitySymbols,
+			CapabilityFunding,
+		},
+		Fields: []ConfigField{
+			{Name: "passphrase", Description: "passphrase of the API key", Required: true},
+		},
+	})
+}
+
+func NewOKXSwap(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx) (Exchange, error) {
+	return newOKXSwap(ctx, portfolio, scrapeCtx, okxBaseURL, http.DefaultTransport)
+}
+
+// newOKXSwap creates the exchange against the api at baseURL, so it can
+// be pointed at a fake server.
+func newOKXSwap(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx, baseURL string, transport http.RoundTripper) (*okxSwap, error) {
+	exchange := &okxSwap{
+		portfolio: portfolio,
+		ctx:       scrapeCtx,
+		baseURL:   baseURL,
+		client: &http.Client{Transport: &okxTransport{
+			ctx:                 scrapeCtx,
+			UnderlyingTransport: transport,
+		}},
+	}
+
+	if err := exchange.get(ctx, "/api/v5/public/time", url.Values{}, false, nil); err != nil {
+		return nil, fmt.Errorf("failed to ping okx api: %v", err)
+	}
+
+	return exchange, nil
+}
+
+type okxTicker struct {
+	InstID string `json:"instId"`
+	Last   string `json:"last"`
+}
+
+func (e *okxSwap) GetSymbolPrices(ctx context.Context) ([]*model.SymbolPrice, error) {
+	var tickers []*okxTicker
+	params := url.Values{"instType": {okxInstType}}
+	if err := e.get(ctx, "/api/v5/market/tickers", params, false, &tickers); err != nil {
+		return nil, err
+	}
+
+	var prices []*model.SymbolPrice
+	for _, ticker := range tickers {
+		price, err := okxFloat(ticker.Last)
+		if err != nil {
+			return nil, err
+		}
+
+		prices = append(prices, &model.SymbolPrice{Symbol: ticker.InstID, Price: price})
+	}
+
+	return prices, nil
+}
+
+func (e *okxSwap) GetBalance(ctx context.Context) (map[string]float64, error) {
+	var accounts []struct {
+		Details []struct {
+			Ccy     string `json:"ccy"`
+			CashBal string `json:"cashBal"`
+		} `json:"details"`
+	}
+
+	if err := e.get(ctx, "/api/v5/account/balance", url.Values{}, true, &accounts); err != nil {
+		return nil, err
+	}
+
+	balances := map[string]float64{}
+	for _, account := range accounts {
+		for _, detail := range account.Details {
+			balance, err := okxFloat(detail.CashBal)
+			if err != nil {
+				return nil, err
+			}
+
+			if balance != 0 {
+				balances[detail.Ccy] += balance
+			}
+		}
+	}
+
+	return balances, nil
+}
+
+// GetAccount returns the margin state of the account. Okx only values the
+// account as a whole, in USD, in multi-currency margin mode, where the
+// available balance is the adjusted equity left by the initial margin.
+// Otherwise every asset is margined on its own, and there are no account
+// figures.
+func (e *okxSwap) GetAccount(ctx context.Context) (*model.AccountSnapshot, error) {
+	var accounts []struct {
+		TotalEq string `json:"totalEq"`
+		AdjEq   string `json:"adjEq"`
+		Imr     string `json:"imr"`
+		Mmr     string `json:"mmr"`
+		Upl     string `json:"upl"`
+		Details []struct {
+			Ccy      string `json:"ccy"`
+			CashBal  string `json:"cashBal"`
+			Upl      string `json:"upl"`
+			Eq       string `json:"eq"`
+			AvailBal string `json:"availBal"`
+			Imr      string `json:"imr"`
+			Mmr      string `json:"mmr"`
+		} `json:"details"`
+	}
+
+	if err := e.get(ctx, "/api/v5/account/balance", url.Values{}, true, &accounts); err != nil {
+		return nil, err
+	}
+
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no account found")
+	}
+
+	account := accounts[0]
+	snapshot := &model.AccountSnapshot{}
+	if account.AdjEq != "" {
+		var err error
+		snapshot, err = accountFigures{
+			Asset:         "USD",
+			WalletBalance: account.TotalEq,
+			UnrealizedPnl: account.Upl,
+			MarginBalance: account.AdjEq,
+			InitialMargin: account.Imr,
+			MaintMargin:   account.Mmr,
+		}.toAccountSnapshot()
+		if err != nil {
+			return nil, err
+		}
+
+		// total equity includes unrealized pnl
+		snapshot.WalletBalance -= snapshot.UnrealizedPnl
+		snapshot.AvailableBalance = math.Max(snapshot.MarginBalance-snapshot.InitialMargin, 0)
+	}
+
+	for _, detail := range account.Details {
+		balance, err := accountFigures{
+			Asset:            detail.Ccy,
+			WalletBalance:    detail.CashBal,
+			UnrealizedPnl:    detail.Upl,
+			MarginBalance:    detail.Eq,
+			AvailableBalance: detail.AvailBal,
+			InitialMargin:    detail.Imr,
+			MaintMargin:      detail.Mmr,
+		}.toAssetBalance()
+		if err != nil {
+			return nil, err
+		}
+
+		if !balance.IsEmpty() {
+			snapshot.Assets = append(snapshot.Assets, balance)
+		}
+	}
+
+	return snapshot, nil
+}
+
+type okxPosition struct {
+	InstID  string `json:"instId"`
+	PosSide string `json:"posSide"`
+	Pos     string `json:"pos"`
+	AvgPx   string `json:"avgPx"`
+	Upl     string `json:"upl"`
+	Lever   string `json:"lever"`
+	MgnMode string `json:"mgnMode"`
+	Imr     string `json:"imr"`
+	Margin  string `json:"margin"`
+	UTime   string `json:"uTime"`
+}
+
+func (e *okxSwap) GetPositions(ctx context.Context) ([]*model.Position, error) {
+	var rawPositions []*okxPosition
+	params := url.Values{"instType": {okxInstType}}
+	if err := e.get(ctx, "/api/v5/account/positions", params, true, &rawPositions); err != nil {
+		return nil, err
+	}
+
+	var positions []*model.Position
+	for _, rawPosition := range rawPositions {
+		position, err := e.parsePosition(ctx, rawPosition)
+		if err != nil {
+			return nil, err
+		}
+
+		if position.IsOpen() {
+			positions = append(positions, position)
+		}
+	}
+
+	return positions, nil
+}
+
+type okxOrder struct {
+	OrdID      string `json:"ordId"`
+	InstID     string `json:"instId"`
+	Side       string `json:"side"`
+	PosSide    string `json:"posSide"`
+	OrdType    string `json:"ordType"`
+	State      string `json:"state"`
+	Px         string `json:"px"`
+	AvgPx      string `json:"avgPx"`
+	Sz         string `json:"sz"`
+	AccFillSz  string `json:"accFillSz"`
+	ReduceOnly string `json:"reduceOnly"`
+	CTime      string `json:"cTime"`
+	UTime      string `json:"uTime"`
+}
+
+func (e *okxSwap) GetOrders(ctx context.Context) ([]*model.Order, error) {
+	params := url.Values{"instType": {okxInstType}}
+	return e.getOrders(ctx, "/api/v5/trade/orders-pending", params)
+}
+
+func (e *okxSwap) GetOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
+	params := url.Values{
+		"instId": {order.Symbol},
+		"ordId":  {order.ExternalID},
+	}
+
+	var rawOrders []*okxOrder
+	if err := e.get(ctx, "/api/v5/trade/order", params, true, &rawOrders); err != nil {
+		if apiErr, ok := err.(*OKXAPIError); ok && apiErr.Code == okxOrderNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(rawOrders) == 0 {
+		return nil, nil
+	}
+
+	return e.parseOrder(ctx, rawOrders[0])
+}
+
+func (e *okxSwap) GetOrdersBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Order, error) {
+	params := url.Values{
+		"instType": {okxInstType},
+		"instId":   {symbol},
+	}
+	okxTimeRange(params, startTime, endTime)
+
+	return e.getOrders(ctx, "/api/v5/trade/orders-history-archive", params)
+}
+
+func (e *okxSwap) getOrders(ctx context.Context, path string, params url.Values) ([]*model.Order, error) {
+	var orders []*model.Order
+	err := e.getList(ctx, path, params, func(list json.RawMessage) (int, string, error) {
+		var rawOrders []*okxOrder
+		if err := json.Unmarshal(list, &rawOrders); err != nil || len(rawOrders) == 0 {
+			return 0, "", err
+		}
+
+		for _, rawOrder := range rawOrders {
+			order, err := e.parseOrder(ctx, rawOrder)
+			if err != nil {
+				return 0, "", err
+			}
+
+			orders = append(orders, order)
+		}
+
+		return len(rawOrders), rawOrders[len(rawOrders)-1].OrdID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+type okxBill struct {
+	BillID  string `json:"billId"`
+	Type    string `json:"type"`
+	InstID  string `json:"instId"`
+	Ccy     string `json:"ccy"`
+	BalChg  string `json:"balChg"`
+	Pnl     string `json:"pnl"`
+	Fee     string `json:"fee"`
+	TradeID string `json:"tradeId"`
+	Ts      string `json:"ts"`
+}
+
+func (e *okxSwap) GetIncome(ctx context.Context) ([]*model.Income, error) {
+	now := time.Now()
+	return e.GetIncomeBetween(ctx, now.Add(-okxHistoryWindow).UnixMilli(), now.UnixMilli())
+}
+
+// GetIncomeBetween returns the bills of the swap account between
+// startTime and endTime, oldest first.
+func (e *okxSwap) GetIncomeBetween(ctx context.Context, startTime, endTime int64) ([]*model.Income, error) {
+	params := url.Values{"instType": {okxInstType}}
+	okxTimeRange(params, startTime, endTime)
+
+	var incomes []*model.Income
+	err := e.getList(ctx, "/api/v5/account/bills-archive", params, func(list json.RawMessage) (int, string, error) {
+		var bills []*okxBill
+		if err := json.Unmarshal(list, &bills); err != nil || len(bills) == 0 {
+			return 0, "", err
+		}
+
+		for _, bill := range bills {
+			page, err := e.parseBill(bill)
+			if err != nil {
+				return 0, "", err
+			}
+
+			incomes = append(incomes, page...)
+		}
+
+		return len(bills), bills[len(bills)-1].BillID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(incomes, func(i, j int) bool {
+		return incomes[i].Date.Before(incomes[j].Date)
+	})
+
+	return incomes, nil
+}
+
+// GetTransfersBetween returns transfers in and out of the trading account.
+func (e *okxSwap) GetTransfersBetween(ctx context.Context, startTime, endTime int64) ([]*model.Transfer, error) {
+	params := url.Values{"type": {okxBillTypeTransfer}}
+	okxTimeRange(params, startTime, endTime)
+
+	var transfers []*model.Transfer
+	err := e.getList(ctx, "/api/v5/account/bills-archive", params, func(list json.RawMessage) (int, string, error) {
+		var bills []*okxBill
+		if err := json.Unmarshal(list, &bills); err != nil || len(bills) == 0 {
+			return 0, "", err
+		}
+
+		for _, bill := range bills {
+			amount, err := okxFloat(bill.BalChg)
+			if err != nil {
+				return 0, "", err
+			}
+
+			date, err := okxTime(bill.Ts)
+			if err != nil {
+				return 0, "", err
+			}
+
+			transferType := model.TransferIn
+			if amount < 0 {
+				transferType = model.TransferOut
+			}
+
+			transfers = append(transfers, &model.Transfer{
+				ExternalID: bill.BillID,
+				Type:       transferType,
+				Asset:      bill.Ccy,
+				Amount:     amount,
+				Date:       date,
+			})
+		}
+
+		return len(bills), bills[len(bills)-1].BillID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+type okxFill struct {
+	BillID   string `json:"billId"`
+	TradeID  string `json:"tradeId"`
+	OrdID    string `json:"ordId"`
+	InstID   string `json:"instId"`
+	Side     string `json:"side"`
+	PosSide  string `json:"posSide"`
+	FillPx   string `json:"fillPx"`
+	FillSz   string `json:"fillSz"`
+	FillPnl  string `json:"fillPnl"`
+	Fee      string `json:"fee"`
+	FeeCcy   string `json:"feeCcy"`
+	ExecType string `json:"execType"`
+	Ts       string `json:"ts"`
+}
+
+func (e *okxSwap) GetTrades(ctx context.Context, symbol string) ([]*model.Trade, error) {
+	now := time.Now()
+	return e.GetTradesBetween(ctx, symbol, now.Add(-okxHistoryWindow).UnixMilli(), now.UnixMilli())
+}
+
+func (e *okxSwap) GetTradesBetween(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.Trade, error) {
+	params := url.Values{
+		"instType": {okxInstType},
+		"instId":   {symbol},
+	}
+	okxTimeRange(params, startTime, endTime)
+
+	var trades []*model.Trade
+	err := e.getList(ctx, "/api/v5/trade/fills-history", params, func(list json.RawMessage) (int, string, error) {
+		var fills []*okxFill
+		if err := json.Unmarshal(list, &fills); err != nil || len(fills) == 0 {
+			return 0, "", err
+		}
+
+		for _, fill := range fills {
+			trade, err := e.parseTrade(ctx, fill)
+			if err != nil {
+				return 0, "", err
+			}
+
+			trades = append(trades, trade)
+		}
+
+		return len(fills), fills[len(fills)-1].BillID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trades, nil
+}
+
+func (e *okxSwap) GetCandles(ctx context.Context, symbol, interval string, startTime, endTime int64) ([]*model.Candle, error) {
+	bar, ok := okxCandleBars[interval]
+	if !ok {
+		return nil, fmt.Errorf("unsupported candle interval: %s", interval)
+	}
+
+	return firstCandlePage(interval, okxCandleLimit, startTime, endTime, func(start, end int64) ([]*model.Candle, error) {
+		// candles are [ts, open, high, low, close, vol, volCcy,
+		// volCcyQuote, confirm], vol is counted in contracts
+		var list [][]string
+		params := url.Values{
+			"instId": {symbol},
+			"bar":    {bar},
+			"after":  {strconv.FormatInt(end+1, 10)},
+			"before": {strconv.FormatInt(start-1, 10)},
+			"limit":  {strconv.Itoa(okxCandleLimit)},
+		}
+		if err := e.get(ctx, "/api/v5/market/history-candles", params, false, &list); err != nil {
+			return nil, err
+		}
+
+		var candles []*model.Candle
+		for _, raw := range list {
+			if len(raw) < 8 {
+				return nil, fmt.Errorf("unexpected candle: %v", raw)
+			}
+
+			candle, err := parseKline(symbol, interval, append(raw[:5:5], raw[6], raw[7]))
+			if err != nil {
+				return nil, err
+			}
+
+			candles = append(candles, candle)
+		}
+
+		return candles, nil
+	})
+}
+
+// GetSymbolInfos returns the swaps of okx. Lot sizes of linear swaps are
+// in the base asset, like their positions, and in contracts for inverse
+// ones. Okx sets no minimum notional.
+func (e *okxSwap) GetSymbolInfos(ctx context.Context) ([]*model.SymbolInfo, error) {
+	instruments, err := e.getInstruments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []*model.SymbolInfo
+	for _, instrument := range instruments {
+		info, err := e.parseInstrument(instrument)
+		if err != nil {
+			return nil, err
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+type okxFundingRate struct {
+	FundingRate string `json:"fundingRate"`
+	FundingTime string `json:"fundingTime"`
+}
+
+func (e *okxSwap) GetFundingRates(ctx context.Context, symbol string, startTime, endTime int64) ([]*model.FundingRate, error) {
+	var rates []*model.FundingRate
+	window := okxCandleLimit * time.Hour
+	err := firstWindow(window, startTime, endTime, func(start, end int64) (int, error) {
+		var page []*okxFundingRate
+		params := url.Values{
+			"instId": {symbol},
+			"after":  {strconv.FormatInt(end+1, 10)},
+			"before": {strconv.FormatInt(start-1, 10)},
+			"limit":  {strconv.Itoa(okxCandleLimit)},
+		}
+		if err := e.get(ctx, "/api/v5/public/funding-rate-history", params, false, &page); err != nil {
+			return 0, err
+		}
+
+		// rates are listed newest first
+		for i := len(page) - 1; i >= 0; i-- {
+			rate, err := okxFloat(page[i].FundingRate)
+			if err != nil {
+				return 0, err
+			}
+
+			date, err := okxTime(page[i].FundingTime)
+			if err != nil {
+				return 0, err
+			}
+
+			rates = append(rates, &model.FundingRate{Symbol: symbol, Date: date, Rate: rate})
+		}
+
+		return len(page), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = fillMarkPrices(rates, func(start, end int64) ([]*model.Candle, error) {
+		return firstCandlePage("1h", okxCandleLimit, start, end, func(start, end int64) ([]*model.Candle, error) {
+			// candles are [ts, open, high, low, close, confirm]
+			var list [][]string
+			params := url.Values{
+				"instId": {symbol},
+				"bar":    {okxCandleBars["1h"]},
+				"after":  {strconv.FormatInt(end+1, 10)},
+				"before": {strconv.FormatInt(start-1, 10)},
+				"limit":  {strconv.Itoa(okxCandleLimit)},
+			}
+			if err := e.get(ctx, "/api/v5/market/history-mark-price-candles", params, false, &list); err != nil {
+				return nil, err
+			}
+
+			var candles []*model.Candle
+			for _, raw := range list {
+				if len(raw) < 5 {
+					return nil, fmt.Errorf("unexpected candle: %v", raw)
+				}
+
+				candle, err := parseKline(symbol, "1h", raw[:5])
+				if err != nil {
+					return nil, err
+				}
+
+				candles = append(candles, candle)
+			}
+
+			return candles, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+// okxTimeRange sets the time range of a history query, limited to the
+// range archive endpoints keep.
+func okxTimeRange(params url.Values, startTime, endTime int64) {
+	if oldest := time.Now().Add(-okxHistoryRetention).UnixMilli(); startTime < oldest {
+		startTime = oldest
+	}
+
+	params.Set("begin", strconv.FormatInt(startTime, 10))
+	if endTime > 0 {
+		params.Set("end", strconv.FormatInt(endTime, 10))
+	}
+}
+
+type okxResponse struct {
+	Code string          `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// get sends a request to the okx api and decodes its data into result.
+func (e *okxSwap) get(ctx context.Context, path string, params url.Values, signed bool, result interface{}) error {
+	requestPath := path
+	if len(params) > 0 {
+		requestPath += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.baseURL+requestPath, nil)
+	if err != nil {
+		return err
+	}
+
+	if signed {
+		timestamp := time.Now().UTC().Format(okxTimestampFormat)
+		mac := hmac.New(sha256.New, []byte(e.portfolio.APISecret))
+		mac.Write([]byte(timestamp + http.MethodGet + requestPath))
+
+		req.Header.Set("OK-ACCESS-KEY", e.portfolio.APIKey)
+		req.Header.Set("OK-ACCESS-SIGN", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+		req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+		req.Header.Set("OK-ACCESS-PASSPHRASE", e.portfolio.Option("passphrase"))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	response := &okxResponse{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("unexpected response, status %d: %v", resp.StatusCode, err)
+	}
+
+	if response.Code != "0" {
+		if response.Code == okxRateLimited {
+			e.ctx.Weight.Backoff(okxRateLimitBackoff)
+		}
+		return &OKXAPIError{Code: response.Code, Message: response.Msg}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Data, result)
+}
+
+// getList walks the pages of a signed list endpoint, newest first. each
+// is called with the raw data of every page and returns the number of
+// records on it and the id of the last one, which the next page follows.
+func (e *okxSwap) getList(ctx context.Context, path string, params url.Values, each func(list json.RawMessage) (int, string, error)) error {
+	params.Set("limit", strconv.Itoa(okxPageLimit))
+	for {
+		var list json.RawMessage
+		if err := e.get(ctx, path, params, true, &list); err != nil {
+			return err
+		}
+
+		n, last, err := each(list)
+		if err != nil {
+			return err
+		}
+
+		if n < okxPageLimit || last == "" {
+			return nil
+		}
+		params.Set("after", last)
+	}
+}
+
+type okxInstrument struct {
+	InstID    string `json:"instId"`
+	CtType    string `json:"ctType"`
+	CtVal     string `json:"ctVal"`
+	CtMult    string `json:"ctMult"`
+	SettleCcy string `json:"settleCcy"`
+	TickSz    string `json:"tickSz"`
+	LotSz     string `json:"lotSz"`
+	State     string `json:"state"`
+	ListTime  string `json:"listTime"`
+	ExpTime   string `json:"expTime"`
+}
+
+func (e *okxSwap) getInstruments(ctx context.Context) ([]*okxInstrument, error) {
+	var instruments []*okxInstrument
+	params := url.Values{"instType": {okxInstType}}
+	if err := e.get(ctx, "/api/v5/public/instruments", params, false, &instruments); err != nil {
+		return nil, err
+	}
+
+	return instruments, nil
+}
+
+// contractSize returns the amount of the base asset in one contract of the
+// instrument. Inverse swaps, and instruments no longer listed, are counted
+// in contracts.
+func (e *okxSwap) contractSize(ctx context.Context, instID string) (float64, error) {
+	if e.contractSizes == nil {
+		instruments, err := e.getInstruments(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		e.contractSizes = make(map[string]float64, len(instruments))
+		for _, instrument := range instruments {
+			size, err := okxInstrumentSize(instrument)
+			if err != nil {
+				return 0, err
+			}
+
+			e.contractSizes[instrument.InstID] = size
+		}
+	}
+
+	if size, ok := e.contractSizes[instID]; ok && size > 0 {
+		return size, nil
+	}
+
+	return 1, nil
+}
+
+// okxInstrumentSize returns the contract size of linear instruments, or 1
+// for inverse ones.
+func okxInstrumentSize(instrument *okxInstrument) (float64, error) {
+	if instrument.CtType != "linear" {
+		return 1, nil
+	}
+
+	ctVal, err := okxFloat(instrument.CtVal)
+	if err != nil {
+		return 0, err
+	}
+
+	ctMult, err := okxFloat(instrument.CtMult)
+	if err != nil {
+		return 0, err
+	}
+
+	return ctVal * ctMult, nil
+}
+
+func (e *okxSwap) toAmount(ctx context.Context, instID, contracts string) (float64, error) {
+	amount, err := okxFloat(contracts)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := e.contractSize(ctx, instID)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount * size, nil
+}
+
+func (e *okxSwap) parsePosition(ctx context.Context, position *okxPosition) (*model.Position, error) {
+	amount, err := e.toAmount(ctx, position.InstID, position.Pos)
+	if err != nil {
+		return nil, err
+	}
+
+	if position.PosSide == "short" {
+		amount = -amount
+	}
+
+	margin := position.Imr
+	if position.MgnMode == "isolated" {
+		margin = position.Margin
+	}
+
+	cost, err := okxFloat(margin)
+	if err != nil {
+		return nil, err
+	}
+
+	ePrice, err := okxFloat(position.AvgPx)
+	if err != nil {
+		return nil, err
+	}
+
+	unpnl, err := okxFloat(position.Upl)
+	if err != nil {
+		return nil, err
+	}
+
+	lev, err := okxFloat(position.Lever)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := okxTime(position.UTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Position{
+		Symbol:     position.InstID,
+		Amount:     amount,
+		Cost:       cost,
+		EntryPrice: ePrice,
+		Isolated:   position.MgnMode == "isolated",
+		UnPnl:      unpnl,
+		Side:       okxPositionSides[position.PosSide],
+		Leverage:   int32(lev),
+		Date:       date,
+	}, nil
+}
+
+func (e *okxSwap) parseOrder(ctx context.Context, order *okxOrder) (*model.Order, error) {
+	price, err := okxFloat(order.Px)
+	if err != nil {
+		return nil, err
+	}
+
+	avgPrice, err := okxFloat(order.AvgPx)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := e.toAmount(ctx, order.InstID, order.Sz)
+	if err != nil {
+		return nil, err
+	}
+
+	executed, err := e.toAmount(ctx, order.InstID, order.AccFillSz)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := okxTime(order.CTime)
+	if err != nil {
+		return nil, err
+	}
+
+	updateDate, err := okxTime(order.UTime)
+	if err != nil {
+		return nil, err
+	}
+
+	status, ok := okxOrderStatuses[order.State]
+	if !ok {
+		status = strings.ToUpper(order.State)
+	}
+
+	orderType, ok := okxOrderTypes[order.OrdType]
+	if !ok {
+		orderType = [2]string{strings.ToUpper(order.OrdType), ""}
+	}
+
+	return &model.Order{
+		ID:             okxID(order.OrdID),
+		ExternalID:     order.OrdID,
+		Symbol:         order.InstID,
+		Side:           strings.ToUpper(order.Side),
+		PositionSide:   okxPositionSides[order.PosSide],
+		TimeInForce:    orderType[1],
+		Type:           orderType[0],
+		Status:         status,
+		Price:          price,
+		AvgPrice:       avgPrice,
+		Amount:         amount,
+		ExecutedAmount: executed,
+		ReduceOnly:     order.ReduceOnly == "true",
+		Date:           date,
+		UpdateDate:     updateDate,
+	}, nil
+}
+
+// parseBill converts a bill into income. Trade bills are split into
+// realized pnl and commission, the way binance reports them.
+func (e *okxSwap) parseBill(bill *okxBill) ([]*model.Income, error) {
+	date, err := okxTime(bill.Ts)
+	if err != nil {
+		return nil, err
+	}
+
+	var tradeID int64 = -1
+	if bill.TradeID != "" {
+		tradeID = okxID(bill.TradeID)
+	}
+
+	income := func(incomeType, amount string) (*model.Income, error) {
+		value, err := okxFloat(amount)
+		if err != nil {
+			return nil, err
+		}
+
+		return &model.Income{
+			ID:      okxID(bill.BillID),
+			Type:    incomeType,
+			Symbol:  bill.InstID,
+			Asset:   bill.Ccy,
+			Income:  value,
+			TradeID: tradeID,
+			Date:    date,
+		}, nil
+	}
+
+	if bill.Type != okxBillTypeTrade {
+		incomeType, ok := okxBillTypes[bill.Type]
+		if !ok {
+			incomeType = "BILL_" + bill.Type
+		}
+
+		record, err := income(incomeType, bill.BalChg)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*model.Income{record}, nil
+	}
+
+	var incomes []*model.Income
+	for _, part := range [][2]string{{"REALIZED_PNL", bill.Pnl}, {"COMMISSION", bill.Fee}} {
+		record, err := income(part[0], part[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if record.Income != 0 {
+			incomes = append(incomes, record)
+		}
+	}
+
+	return incomes, nil
+}
+
+func (e *okxSwap) parseInstrument(instrument *okxInstrument) (*model.SymbolInfo, error) {
+	// swaps are named BASE-QUOTE-SWAP
+	parts := strings.Split(instrument.InstID, "-")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("unexpected instrument: %s", instrument.InstID)
+	}
+
+	info := &model.SymbolInfo{
+		Symbol:       instrument.InstID,
+		BaseAsset:    parts[0],
+		QuoteAsset:   parts[1],
+		MarginAsset:  instrument.SettleCcy,
+		ContractType: "PERPETUAL",
+		Status:       okxInstrumentStates[instrument.State],
+	}
+
+	if info.Status == "" {
+		info.Status = model.SymbolStatusHalted
+	}
+
+	var err error
+	if info.TickSize, err = okxFloat(instrument.TickSz); err != nil {
+		return nil, err
+	}
+
+	if info.LotSize, err = okxFloat(instrument.LotSz); err != nil {
+		return nil, err
+	}
+
+	size, err := okxInstrumentSize(instrument)
+	if err != nil {
+		return nil, err
+	}
+	info.LotSize *= size
+
+	if info.ListDate, err = okxTime(instrument.ListTime); err != nil {
+		return nil, err
+	}
+
+	// swaps are given an expiry once they are to be delisted
+	if info.DelistDate, err = okxTime(instrument.ExpTime); err != nil {
+		return nil, err
+	}
+
+	if !info.DelistDate.IsZero() && info.Status == model.SymbolStatusTrading {
+		info.Status = model.SymbolStatusDelisting
+	}
+
+	return info, nil
+}
+
+func (e *okxSwap) parseTrade(ctx context.Context, fill *okxFill) (*model.Trade, error) {
+	price, err := okxFloat(fill.FillPx)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := e.toAmount(ctx, fill.InstID, fill.FillSz)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := okxFloat(fill.Fee)
+	if err != nil {
+		return nil, err
+	}
+
+	pnl, err := okxFloat(fill.FillPnl)
+	if err != nil {
+		return nil, err
+	}
+
+	date, err := okxTime(fill.Ts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Trade{
+		ID:              okxID(fill.TradeID),
+		Symbol:          fill.InstID,
+		OrderID:         okxID(fill.OrdID),
+		Side:            strings.ToUpper(fill.Side),
+		PositionSide:    okxPositionSides[fill.PosSide],
+		Price:           price,
+		Amount:          amount,
+		QuoteAmount:     price * amount,
+		Commission:      -fee,
+		CommissionAsset: fill.FeeCcy,
+		RealizedPnl:     pnl,
+		Buyer:           fill.Side == "buy",
+		Maker:           fill.ExecType == "M",
+		Date:            date,
+	}, nil
+}
+
+// okxFloat parses an okx decimal, which is empty when it has no value.
+func okxFloat(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+func okxTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.UnixMilli(ms), nil
+}
+
+// okxID parses an okx id, which is numeric but sent as a string. Ids that
+// are not numeric are hashed.
+func okxID(s string) int64 {
+	if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return id
+	}
+
+	return hashID(s)
+}
@@ -0,0 +1,121 @@
+package exchange
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultRetryAfter = time.Minute
+
+// WeightBudget limits the exchange request weight used by every
+// portfolio that shares the same API key. Weight is counted in fixed
+// windows, the way exchanges count it, and is synced with the usage
+// reported by the exchange.
+type WeightBudget struct {
+	mu sync.Mutex
+
+	used        int32
+	window      time.Time
+	bannedUntil time.Time
+
+	limit    int32
+	duration time.Duration
+}
+
+func NewWeightBudget(limit int32) *WeightBudget {
+	return &WeightBudget{limit: limit, duration: time.Minute}
+}
+
+// Reserve blocks until the weight fits into the budget of the current
+// window, or until ctx is done.
+func (b *WeightBudget) Reserve(ctx context.Context, weight int32) error {
+	for {
+		wait := b.reserve(weight)
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (b *WeightBudget) reserve(weight int32) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.roll(now)
+
+	if now.Before(b.bannedUntil) {
+		return b.bannedUntil.Sub(now)
+	}
+
+	if b.used > 0 && b.used+weight > b.limit {
+		return b.window.Add(b.duration).Sub(now)
+	}
+
+	b.used += weight
+	return 0
+}
+
+// Sync updates the budget with the weight reported by the exchange.
+func (b *WeightBudget) Sync(used int32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll(time.Now())
+	if used > b.used {
+		b.used = used
+	}
+}
+
+// Backoff blocks all reservations for the given duration.
+func (b *WeightBudget) Backoff(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(b.bannedUntil) {
+		b.bannedUntil = until
+	}
+}
+
+func (b *WeightBudget) Used() int32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.roll(time.Now())
+	return b.used
+}
+
+func (b *WeightBudget) Limit() int32 {
+	return b.limit
+}
+
+func (b *WeightBudget) roll(now time.Time) {
+	window := now.Truncate(b.duration)
+	if window.After(b.window) {
+		b.window = window
+		b.used = 0
+	}
+}
+
+// retryAfter returns the backoff requested by the exchange in the
+// Retry-After header of a rate limited response.
+func retryAfter(header http.Header) time.Duration {
+	secs, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || secs <= 0 {
+		return defaultRetryAfter
+	}
+
+	return time.Duration(secs) * time.Second
+}
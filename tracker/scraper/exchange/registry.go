@@ -0,0 +1,127 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+)
+
+// Capability is a kind of data an exchange adapter can scrape.
+type Capability string
+
+const (
+	CapabilityPrices    Capability = "prices"
+	CapabilityBalance   Capability = "balance"
+	CapabilityAccount   Capability = "account"
+	CapabilityPositions Capability = "positions"
+	CapabilityOrders    Capability = "orders"
+	CapabilityIncome    Capability = "income"
+	CapabilityTrades    Capability = "trades"
+	CapabilityTransfers Capability = "transfers"
+	CapabilityCandles   Capability = "candles"
+	CapabilityFunding   Capability = "funding"
+	CapabilitySymbols   Capability = "symbols"
+	CapabilityUserData  Capability = "stream"
+)
+
+// Constructor creates an exchange for the portfolio, sending requests
+// within the weight budget of scrapeCtx. ctx bounds the requests sent while
+// connecting.
+type Constructor func(ctx context.Context, portfolio *model.Portfolio, scrapeCtx *model.ScrapeCtx) (Exchange, error)
+
+// ConfigField is a portfolio config field an adapter reads beside the
+// API key and secret, from model.Portfolio.Options.
+type ConfigField struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Definition describes an exchange adapter.
+type Definition struct {
+	// Name is what portfolios set as their exchange in the config.
+	Name         string
+	Description  string
+	New          Constructor
+	Capabilities []Capability
+	Fields       []ConfigField
+	// WeightLimit is the request weight the adapter uses per minute and
+	// API key, in the weight units of the exchange. Exchanges that do not
+	// weigh requests count each as 1.
+	WeightLimit int32
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Definition{}
+)
+
+// Register makes an exchange adapter available by its name. It is meant
+// to be called from the init function of the package implementing the
+// adapter, and panics if the name is taken or the definition is incomplete.
+func Register(def Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if def.Name == "" || def.New == nil {
+		panic("exchange: Register needs a name and a constructor")
+	}
+
+	if _, ok := registry[def.Name]; ok {
+		panic("exchange: Register called twice for " + def.Name)
+	}
+
+	registry[def.Name] = &def
+}
+
+// Lookup returns the definition of the exchange adapter registered under
+// name, or nil if there is none.
+func Lookup(name string) *Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return registry[name]
+}
+
+// Definitions returns every registered exchange adapter, sorted by name.
+func Definitions() []*Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	defs := make([]*Definition, 0, len(registry))
+	for _, def := range registry {
+		defs = append(defs, def)
+	}
+
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+
+	return defs
+}
+
+// Validate checks the portfolio sets every config field the adapter
+// requires.
+func (d *Definition) Validate(portfolio *model.Portfolio) error {
+	for _, field := range d.Fields {
+		if field.Required && portfolio.Option(field.Name) == "" {
+			return fmt.Errorf("%s requires config field %q", d.Name, field.Name)
+		}
+	}
+
+	return nil
+}
+
+// Supports reports whether the adapter declares the capability.
+func (d *Definition) Supports(capability Capability) bool {
+	for _, c := range d.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"context"
+	"time"
+)
+
+// fundingLookback is how far back funding rates of a symbol the portfolio
+// has not paid funding on yet are first scraped.
+const fundingLookback = 24 * time.Hour
+
+// ScrapeFundingRates brings funding rates of every symbol the portfolio
+// holds or has paid funding on up to date, so funding payments can be
+// explained by the rate and the position at the time. Rates of a symbol
+// first reach back to its earliest funding payment.
+func (s *portfolioScraper) ScrapeFundingRates(ctx context.Context) error {
+	s.logf("scraping funding rates")
+
+	symbols, err := s.repo.GetFundingSymbols(s.ctx.Portfolio)
+	if err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		// symbols may have been delisted since they were held
+		if err := s.scrapeSymbolFundingRates(ctx, symbol); err != nil {
+			s.logf("failed to scrape funding rates of %s: %v", symbol, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *portfolioScraper) scrapeSymbolFundingRates(ctx context.Context, symbol string) error {
+	exchange := s.ctx.Portfolio.Exchange
+	now := time.Now().UnixMilli()
+
+	start, err := s.fundingCursor(symbol)
+	if err != nil {
+		return err
+	}
+
+	for start <= now {
+		rates, err := s.funding.GetFundingRates(ctx, symbol, start, now)
+		if err != nil {
+			return err
+		}
+
+		if len(rates) == 0 {
+			return nil
+		}
+
+		for _, rate := range rates {
+			rate.Exchange = exchange
+		}
+
+		if err := s.repo.CreateFundingRates(rates); err != nil {
+			return err
+		}
+
+		next := rates[len(rates)-1].Date.UnixMilli() + 1
+		if next <= start {
+			return nil
+		}
+		start = next
+	}
+
+	return nil
+}
+
+func (s *portfolioScraper) fundingCursor(symbol string) (int64, error) {
+	latest, err := s.repo.GetLatestFundingRate(s.ctx.Portfolio.Exchange, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	if latest != nil {
+		return latest.Date.UnixMilli() + 1, nil
+	}
+
+	income, err := s.repo.GetEarliestFundingIncome(s.ctx.Portfolio, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	// payments are credited at or shortly after the funding time
+	if income != nil {
+		return income.Date.Add(-time.Hour).UnixMilli(), nil
+	}
+
+	return time.Now().Add(-fundingLookback).UnixMilli(), nil
+}
@@ -0,0 +1,192 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+)
+
+// journal records the outcome of every task of a scrape run. A nil journal
+// records nothing, for scrapes outside of a run.
+type journal struct {
+	repo repository.Repository
+	run  *model.ScrapeRun
+}
+
+func startJournal(repo repository.Repository) (*journal, error) {
+	run := &model.ScrapeRun{StartedAt: time.Now()}
+	if err := repo.CreateScrapeRun(run); err != nil {
+		return nil, fmt.Errorf("failed to create scrape run: %v", err)
+	}
+
+	return &journal{repo: repo, run: run}, nil
+}
+
+// finish records the end of the run, and the error it failed with if any.
+func (j *journal) finish(err error) {
+	j.run.EndedAt = time.Now()
+	if err != nil {
+		j.run.Error = err.Error()
+	}
+
+	if err := j.repo.UpdateScrapeRun(j.run); err != nil {
+		log.Print(fmt.Errorf("failed to update scrape run: %v", err))
+	}
+}
+
+// record runs the task, retrying transient failures, and records how long
+// it took, the attempts it made, the weight it used through scrapeCtx and
+// the rows it wrote through repo.
+func (j *journal) record(ctx context.Context, scrapeCtx *model.ScrapeCtx, repo *countingRepo, task string, run func() error) error {
+	name := fmt.Sprintf("[%s] %s", scrapeCtx.PortfolioID, task)
+	if j == nil {
+		_, err := retry(ctx, name, run)
+		return err
+	}
+
+	result := &model.ScrapeTaskResult{
+		RunID:       j.run.ID,
+		PortfolioID: scrapeCtx.PortfolioID,
+		Task:        task,
+		StartedAt:   time.Now(),
+	}
+
+	repo.take()
+	weight := scrapeCtx.WeightUsed()
+
+	attempts, err := retry(ctx, name, run)
+
+	result.EndedAt = time.Now()
+	result.Attempts = attempts
+	result.Rows = repo.take()
+	result.Weight = scrapeCtx.WeightUsed() - weight
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	j.save(result)
+	return err
+}
+
+// skip records the task as skipped, for the reason if one is given.
+func (j *journal) skip(scrapeCtx *model.ScrapeCtx, task, reason string) {
+	if j == nil {
+		return
+	}
+
+	now := time.Now()
+	j.save(&model.ScrapeTaskResult{
+		RunID:       j.run.ID,
+		PortfolioID: scrapeCtx.PortfolioID,
+		Task:        task,
+		StartedAt:   now,
+		EndedAt:     now,
+		Skipped:     true,
+		Error:       reason,
+	})
+}
+
+// save stores the result. A journal that cannot be written should not fail
+// the scrape it journals, so errors are only logged.
+func (j *journal) save(result *model.ScrapeTaskResult) {
+	if err := j.repo.CreateScrapeTaskResult(result); err != nil {
+		log.Print(fmt.Errorf("failed to record %s of portfolio %s: %v", result.Task, result.PortfolioID, err))
+	}
+}
+
+// countingRepo counts the rows written through it.
+type countingRepo struct {
+	repository.Repository
+
+	rows int64
+}
+
+func newCountingRepo(repo repository.Repository) *countingRepo {
+	return &countingRepo{Repository: repo}
+}
+
+// take returns the rows written since it was last called.
+func (r *countingRepo) take() int64 {
+	return atomic.SwapInt64(&r.rows, 0)
+}
+
+func (r *countingRepo) count(rows int, err error) error {
+	if err == nil {
+		atomic.AddInt64(&r.rows, int64(rows))
+	}
+
+	return err
+}
+
+func (r *countingRepo) CreateSymbolPrices(prices []*model.SymbolPrice) error {
+	return r.count(len(prices), r.Repository.CreateSymbolPrices(prices))
+}
+
+func (r *countingRepo) CreatePriceSamples(samples []*model.PriceSample) error {
+	return r.count(len(samples), r.Repository.CreatePriceSamples(samples))
+}
+
+func (r *countingRepo) CreatePosition(position *model.Position) error {
+	return r.count(1, r.Repository.CreatePosition(position))
+}
+
+func (r *countingRepo) ReplacePosition(position *model.Position) error {
+	return r.count(1, r.Repository.ReplacePosition(position))
+}
+
+func (r *countingRepo) ReplacePositions(portfolio *model.Portfolio, positions []*model.Position) error {
+	return r.count(len(positions), r.Repository.ReplacePositions(portfolio, positions))
+}
+
+func (r *countingRepo) CreatePositionSnapshot(snapshot *model.PositionSnapshot) error {
+	return r.count(1, r.Repository.CreatePositionSnapshot(snapshot))
+}
+
+func (r *countingRepo) CreateAccountSnapshot(snapshot *model.AccountSnapshot) error {
+	return r.count(1+len(snapshot.Assets), r.Repository.CreateAccountSnapshot(snapshot))
+}
+
+func (r *countingRepo) CreateOrder(order *model.Order) error {
+	return r.count(1, r.Repository.CreateOrder(order))
+}
+
+func (r *countingRepo) CreateIncome(income *model.Income) error {
+	return r.count(1, r.Repository.CreateIncome(income))
+}
+
+func (r *countingRepo) CreateTrade(trade *model.Trade) error {
+	return r.count(1, r.Repository.CreateTrade(trade))
+}
+
+func (r *countingRepo) CreateTransfer(transfer *model.Transfer) error {
+	return r.count(1, r.Repository.CreateTransfer(transfer))
+}
+
+func (r *countingRepo) LinkTransfers(transfer, counter *model.Transfer) error {
+	return r.count(2, r.Repository.LinkTransfers(transfer, counter))
+}
+
+func (r *countingRepo) CreateDailyBalance(balance *model.DailyBalance) error {
+	return r.count(1, r.Repository.CreateDailyBalance(balance))
+}
+
+func (r *countingRepo) CreateCandles(candles []*model.Candle) error {
+	return r.count(len(candles), r.Repository.CreateCandles(candles))
+}
+
+func (r *countingRepo) CreateFundingRates(rates []*model.FundingRate) error {
+	return r.count(len(rates), r.Repository.CreateFundingRates(rates))
+}
+
+func (r *countingRepo) UpdateSymbolInfos(exchange string, infos []*model.SymbolInfo) error {
+	return r.count(len(infos), r.Repository.UpdateSymbolInfos(exchange, infos))
+}
+
+func (r *countingRepo) UpdateCurrentBalance(balance *model.CurrentBalance) error {
+	return r.count(1, r.Repository.UpdateCurrentBalance(balance))
+}
@@ -0,0 +1,901 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper/exchange"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/valuation"
+)
+
+// defaultIncomeLookback is how far back income is scraped for portfolios
+// that have no income cursor and do not scrape their whole history.
+const defaultIncomeLookback = 7 * 24 * time.Hour
+
+// transferOverlap is how much of the previous scrape's range transfers
+// are scraped again, so deposits credited late are not missed.
+const transferOverlap = 24 * time.Hour
+
+// historyOverlap is how much of the previous scrape's range the trades and
+// orders of a symbol are scraped again, so records the exchange reports
+// late are not missed.
+const historyOverlap = time.Hour
+
+// marginRatioWarning is the margin ratio from which accounts are logged as
+// close to a margin call.
+const marginRatioWarning = 0.8
+
+// portfolioScraper runs scrape tasks for a single portfolio. Every
+// portfolio gets its own instance, so they can be scraped concurrently.
+type portfolioScraper struct {
+	repo      repository.Repository
+	converter valuation.Converter
+	exchange  exchange.Exchange
+	ctx       *model.ScrapeCtx
+
+	// rows counts the rows written through repo, journal records tasks
+	// when the scrape is part of a run
+	rows    *countingRepo
+	journal *journal
+
+	// unpriced holds the assets found without a price, logged once each
+	unpriced map[string]bool
+
+	// optional capabilities of the exchange, nil when not implemented
+	account   exchange.AccountReader
+	positions exchange.PositionReader
+	orders    exchange.OrderReader
+	income    exchange.IncomeReader
+	trades    exchange.TradeReader
+	transfers exchange.TransferReader
+	candles   exchange.CandleReader
+	funding   exchange.FundingReader
+}
+
+// scrapeTask is a portfolio scrape task and the exchange capability it
+// needs to run.
+type scrapeTask struct {
+	name       string
+	capability exchange.Capability
+	run        func(ctx context.Context) error
+}
+
+// portfolioTasks are the tasks of a portfolio scrape, in the order they
+// run.
+var portfolioTasks = []struct {
+	name       string
+	capability exchange.Capability
+	run        func(s *portfolioScraper, ctx context.Context) error
+}{
+	{"balance", exchange.CapabilityBalance, (*portfolioScraper).ScrapeBalance},
+	{"account", exchange.CapabilityAccount, (*portfolioScraper).ScrapeAccount},
+	{"positions", exchange.CapabilityPositions, (*portfolioScraper).ScrapePositions},
+	{"income", exchange.CapabilityIncome, (*portfolioScraper).ScrapeIncome},
+	{"trades", exchange.CapabilityTrades, (*portfolioScraper).ScrapeTrades},
+	{"orders", exchange.CapabilityOrders, (*portfolioScraper).ScrapeOrders},
+	{"transfers", exchange.CapabilityTransfers, (*portfolioScraper).ScrapeTransfers},
+	{"balance history", exchange.CapabilityIncome, (*portfolioScraper).DeriveBalanceHistory},
+	{"candles", exchange.CapabilityCandles, (*portfolioScraper).ScrapeCandles},
+	{"funding", exchange.CapabilityFunding, (*portfolioScraper).ScrapeFundingRates},
+}
+
+func newPortfolioScraper(repo repository.Repository, e exchange.Exchange, ctx *model.ScrapeCtx) *portfolioScraper {
+	rows := newCountingRepo(repo)
+	s := &portfolioScraper{
+		repo:      rows,
+		converter: valuation.NewConverter(repo),
+		exchange:  e,
+		ctx:       ctx,
+		rows:      rows,
+		unpriced:  map[string]bool{},
+	}
+
+	s.account, _ = e.(exchange.AccountReader)
+	s.positions, _ = e.(exchange.PositionReader)
+	s.orders, _ = e.(exchange.OrderReader)
+	s.income, _ = e.(exchange.IncomeReader)
+	s.trades, _ = e.(exchange.TradeReader)
+	s.transfers, _ = e.(exchange.TransferReader)
+	s.candles, _ = e.(exchange.CandleReader)
+	s.funding, _ = e.(exchange.FundingReader)
+
+	return s
+}
+
+// Scrape runs the named tasks, or all of them when none are named, in the
+// order of portfolioTasks. Tasks the exchange does not support are skipped
+// rather than failed.
+func (s *portfolioScraper) Scrape(ctx context.Context, names ...string) error {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	var tasks []scrapeTask
+	for _, task := range portfolioTasks {
+		if len(names) > 0 && !selected[task.name] {
+			continue
+		}
+
+		run := task.run
+		tasks = append(tasks, scrapeTask{task.name, task.capability, func(ctx context.Context) error {
+			return run(s, ctx)
+		}})
+	}
+
+	if err := s.runTasks(ctx, tasks); err != nil {
+		return err
+	}
+
+	s.logf("used weight: %d/%d", s.ctx.Weight.Used(), s.ctx.Weight.Limit())
+	return nil
+}
+
+// taskWindDown is how long a running task is given to finish once the
+// scrape is cancelled, before its requests are cancelled too.
+const taskWindDown = 30 * time.Second
+
+// runTasks runs the tasks in order. A failed task does not keep the tasks
+// after it from running, and the failures are returned together once all
+// have run. Once ctx is done, no other task is started, and the running one
+// is given taskWindDown to finish before it is cancelled, saving what it
+// scraped by then.
+func (s *portfolioScraper) runTasks(ctx context.Context, tasks []scrapeTask) error {
+	failures := &taskErrors{}
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !exchange.Implements(s.exchange, task.capability) {
+			s.logf("skipped %s, not supported by %s", task.name, s.ctx.Portfolio.Exchange)
+			s.journal.skip(s.ctx, task.name, "")
+			continue
+		}
+
+		taskCtx, cancel := windDownContext(ctx, taskWindDown)
+		run := func() error { return task.run(taskCtx) }
+		err := s.journal.record(ctx, s.ctx, s.rows, task.name, run)
+		cancel()
+		if err != nil {
+			s.logf("%s failed: %v", task.name, err)
+			failures.add(task.name, err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if len(failures.errs) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+// taskErrors are the failures of the tasks of a scrape, kept apart so
+// each can be looked into.
+type taskErrors struct {
+	names []string
+	errs  []error
+}
+
+func (e *taskErrors) add(name string, err error) {
+	e.names = append(e.names, name)
+	e.errs = append(e.errs, err)
+}
+
+func (e *taskErrors) Error() string {
+	failures := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		failures[i] = fmt.Sprintf("%s: %v", e.names[i], err)
+	}
+
+	return strings.Join(failures, "; ")
+}
+
+// windDownContext returns a context that is cancelled only once the given
+// time has passed since ctx is done, or once cancel is called.
+func windDownContext(ctx context.Context, windDown time.Duration) (context.Context, context.CancelFunc) {
+	windDownCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-windDownCtx.Done():
+			return
+		case <-ctx.Done():
+		}
+
+		select {
+		case <-windDownCtx.Done():
+		case <-time.After(windDown):
+			cancel()
+		}
+	}()
+
+	return windDownCtx, cancel
+}
+
+func (s *portfolioScraper) ScrapePositions(ctx context.Context) error {
+	s.logf("scraping positions")
+
+	positions, err := s.positions.GetPositions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, position := range positions {
+		position.ScrapeCtx.Apply(s.ctx)
+	}
+
+	if err := s.repo.ReplacePositions(s.ctx.Portfolio, positions); err != nil {
+		return err
+	}
+
+	for _, position := range positions {
+		snapshot := model.NewPositionSnapshot(position)
+		if err := s.repo.CreatePositionSnapshot(snapshot); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ScrapeOrders updates open orders, resolves the final state of orders
+// that are no longer open, and backfills orders opened and closed between
+// scrapes.
+func (s *portfolioScraper) ScrapeOrders(ctx context.Context) error {
+	s.logf("scraping orders")
+
+	stored, err := s.repo.GetOpenOrders(s.ctx.Portfolio)
+	if err != nil {
+		return err
+	}
+
+	orders, err := s.orders.GetOrders(ctx)
+	if err != nil {
+		return err
+	}
+
+	// order IDs are only unique within a symbol
+	type orderKey struct {
+		symbol string
+		id     int64
+	}
+
+	open := map[orderKey]bool{}
+	for _, order := range orders {
+		open[orderKey{order.Symbol, order.ID}] = true
+		if err := s.saveOrder(order); err != nil {
+			return err
+		}
+	}
+
+	for _, order := range stored {
+		if open[orderKey{order.Symbol, order.ID}] {
+			continue
+		}
+
+		closed, err := s.orders.GetOrder(ctx, order)
+		if err != nil {
+			return fmt.Errorf("order %d: %v", order.ID, err)
+		}
+
+		if closed == nil {
+			closed = order
+			closed.Status = model.OrderStatusUnknown
+		}
+
+		if err := s.saveOrder(closed); err != nil {
+			return err
+		}
+	}
+
+	return s.scrapeOrderHistory(ctx)
+}
+
+func (s *portfolioScraper) scrapeOrderHistory(ctx context.Context) error {
+	symbols, err := s.getSymbols(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		start, err := s.orderCursor(symbol)
+		if err != nil {
+			return err
+		}
+
+		end := time.Now()
+		orders, err := s.orders.GetOrdersBetween(ctx, symbol, start, end.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("%s: %v", symbol, err)
+		}
+
+		for _, order := range orders {
+			if err := s.saveOrder(order); err != nil {
+				return err
+			}
+		}
+
+		if err := s.saveHistoryCursor(model.HistoryOrders, symbol, end); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getSymbols returns the symbols the portfolio trades, as stored in the
+// repository and as reported by the exchange.
+func (s *portfolioScraper) getSymbols(ctx context.Context) ([]string, error) {
+	symbols, err := s.repo.GetTradedSymbols(s.ctx.Portfolio)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok := s.exchange.(exchange.SymbolLister)
+	if !ok {
+		return symbols, nil
+	}
+
+	accountSymbols, err := lister.GetAccountSymbols(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, symbol := range symbols {
+		known[symbol] = true
+	}
+
+	for _, symbol := range accountSymbols {
+		if !known[symbol] {
+			known[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	return symbols, nil
+}
+
+func (s *portfolioScraper) saveOrder(order *model.Order) error {
+	order.KeyedScrapeCtx.Apply(s.ctx)
+	return s.repo.CreateOrder(order)
+}
+
+// orderCursor returns the time orders of the symbol should be scraped from:
+// where the last scrape of them ended, or for symbols not scraped since
+// cursors were kept, the latest stored order or the start of the symbol's
+// trade history.
+func (s *portfolioScraper) orderCursor(symbol string) (int64, error) {
+	cursor, err := s.repo.GetHistoryCursor(s.ctx.Portfolio, model.HistoryOrders, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	if cursor != nil {
+		return cursor.Cursor, nil
+	}
+
+	order, err := s.repo.GetLatestOrder(s.ctx.Portfolio, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	if order != nil {
+		return order.Date.UnixMilli(), nil
+	}
+
+	return s.historyCursor(symbol)
+}
+
+func (s *portfolioScraper) ScrapeIncome(ctx context.Context) error {
+	if err := s.valueIncome(); err != nil {
+		return err
+	}
+
+	if config.ScrapeHistory && !s.ctx.Portfolio.HistoryScraped {
+		if err := s.scrapeIncomeHistory(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.logf("scraping recent income")
+
+	cursor := s.ctx.Portfolio.IncomeCursor
+	if cursor == 0 {
+		cursor = time.Now().Add(-defaultIncomeLookback).UnixMilli()
+	}
+
+	for {
+		incomes, err := s.income.GetIncomeBetween(ctx, cursor, time.Now().UnixMilli())
+		if err != nil {
+			return err
+		}
+
+		if len(incomes) == 0 {
+			break
+		}
+
+		newest, err := s.saveIncome(incomes)
+		if err != nil {
+			return err
+		}
+
+		// Rows sharing the newest timestamp may continue on the next page,
+		// so the next page starts at that timestamp, unless it would not
+		// move the cursor forward.
+		if newest <= cursor {
+			newest = cursor + 1
+		}
+		cursor = newest
+
+		if err := s.updateIncomeCursor(cursor); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scrapeIncomeHistory scrapes income backwards from the oldest scraped so
+// far, saving its progress after every page.
+func (s *portfolioScraper) scrapeIncomeHistory(ctx context.Context) error {
+	s.logf("scraping historical income")
+
+	portfolio := s.ctx.Portfolio
+	oldestIncomeTime := time.Now().UnixMilli()
+	if portfolio.IncomeHistoryCursor > 0 {
+		oldestIncomeTime = portfolio.IncomeHistoryCursor - 1
+	}
+
+	for {
+		s.logf("scraping next chunk, used weight: %d/%d", s.ctx.Weight.Used(), s.ctx.Weight.Limit())
+
+		incomes, err := s.income.GetIncomeBetween(ctx, 0, oldestIncomeTime)
+		if err != nil {
+			return err
+		}
+
+		if len(incomes) == 0 {
+			break
+		}
+
+		newest, err := s.saveIncome(incomes)
+		if err != nil {
+			return err
+		}
+
+		if newest > portfolio.IncomeCursor {
+			portfolio.IncomeCursor = newest
+		}
+
+		newOldest := incomes[0].Date.UnixMilli()
+		if newOldest >= oldestIncomeTime {
+			break
+		}
+
+		oldestIncomeTime = newOldest - 1
+		portfolio.IncomeHistoryCursor = newOldest
+		if err := s.repo.UpdatePortfolio(portfolio); err != nil {
+			return err
+		}
+	}
+
+	portfolio.HistoryScraped = true
+	return s.repo.UpdatePortfolio(portfolio)
+}
+
+// saveIncome stores incomes and returns the time of the newest one.
+// Income in assets without a price is stored without a model.QuoteAsset
+// value, which valueIncome fills in once there is one.
+func (s *portfolioScraper) saveIncome(incomes []*model.Income) (int64, error) {
+	var newest int64
+	for _, income := range incomes {
+		quoteIncome, err := s.quoteValue(income.Asset, income.Income, income.Date)
+		if err != nil {
+			return 0, err
+		}
+
+		income.QuoteIncome = quoteIncome
+		income.ScrapeCtx.Apply(s.ctx)
+		if err := s.repo.CreateIncome(income); err != nil {
+			return 0, err
+		}
+
+		if t := income.Date.UnixMilli(); t > newest {
+			newest = t
+		}
+	}
+
+	return newest, nil
+}
+
+// valueIncome values income stored before its asset had a price.
+func (s *portfolioScraper) valueIncome() error {
+	incomes, err := s.repo.GetUnvaluedIncome(s.ctx.Portfolio)
+	if err != nil {
+		return err
+	}
+
+	for _, income := range incomes {
+		quoteIncome, err := s.quoteValue(income.Asset, income.Income, income.Date)
+		if err != nil {
+			return err
+		}
+
+		if quoteIncome == nil {
+			continue
+		}
+
+		income.QuoteIncome = quoteIncome
+		income.Portfolio = s.ctx.Portfolio
+		if err := s.repo.CreateIncome(income); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *portfolioScraper) updateIncomeCursor(cursor int64) error {
+	s.ctx.Portfolio.IncomeCursor = cursor
+	return s.repo.UpdatePortfolio(s.ctx.Portfolio)
+}
+
+func (s *portfolioScraper) ScrapeTrades(ctx context.Context) error {
+	s.logf("scraping trades")
+
+	symbols, err := s.getSymbols(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		start, err := s.tradeCursor(symbol)
+		if err != nil {
+			return err
+		}
+
+		end := time.Now()
+		trades, err := s.trades.GetTradesBetween(ctx, symbol, start, end.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("%s: %v", symbol, err)
+		}
+
+		for _, trade := range trades {
+			trade.KeyedScrapeCtx.Apply(s.ctx)
+			if err := s.repo.CreateTrade(trade); err != nil {
+				return err
+			}
+		}
+
+		if err := s.saveHistoryCursor(model.HistoryTrades, symbol, end); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tradeCursor returns the time trades of the symbol should be scraped from:
+// where the last scrape of them ended, or for symbols not scraped since
+// cursors were kept, the latest stored trade or the start of the symbol's
+// trade history.
+func (s *portfolioScraper) tradeCursor(symbol string) (int64, error) {
+	cursor, err := s.repo.GetHistoryCursor(s.ctx.Portfolio, model.HistoryTrades, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	if cursor != nil {
+		return cursor.Cursor, nil
+	}
+
+	trade, err := s.repo.GetLatestTrade(s.ctx.Portfolio, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	if trade != nil {
+		return trade.Date.UnixMilli(), nil
+	}
+
+	return s.historyCursor(symbol)
+}
+
+// historyCursor returns the time of the earliest income linked to a trade
+// of the symbol, where its trade and order history begins.
+func (s *portfolioScraper) historyCursor(symbol string) (int64, error) {
+	income, err := s.repo.GetEarliestTradeIncome(s.ctx.Portfolio, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	if income != nil {
+		return income.Date.UnixMilli(), nil
+	}
+
+	return time.Now().Add(-defaultIncomeLookback).UnixMilli(), nil
+}
+
+// saveHistoryCursor records that the history of the symbol was scraped up
+// to end, less historyOverlap.
+func (s *portfolioScraper) saveHistoryCursor(history, symbol string, end time.Time) error {
+	return s.repo.SaveHistoryCursor(&model.HistoryCursor{
+		PortfolioID: s.ctx.PortfolioID,
+		History:     history,
+		Symbol:      symbol,
+		Cursor:      end.Add(-historyOverlap).UnixMilli(),
+	})
+}
+
+// ScrapeTransfers stores deposits, withdrawals and transfers of the
+// portfolio, and links those made to or from other portfolios.
+func (s *portfolioScraper) ScrapeTransfers(ctx context.Context) error {
+	s.logf("scraping transfers")
+
+	if err := s.valueTransfers(); err != nil {
+		return err
+	}
+
+	start := s.ctx.Portfolio.TransferCursor
+	if start == 0 && !config.ScrapeHistory {
+		start = time.Now().Add(-defaultIncomeLookback).UnixMilli()
+	}
+	end := time.Now()
+
+	transfers, err := s.transfers.GetTransfersBetween(ctx, start, end.UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	// transfers in assets without a price are stored without a
+	// model.QuoteAsset value, which valueTransfers fills in once there is one
+	for _, transfer := range transfers {
+		quoteAmount, err := s.quoteValue(transfer.Asset, transfer.Amount, transfer.Date)
+		if err != nil {
+			return err
+		}
+
+		transfer.QuoteAmount = quoteAmount
+		transfer.ScrapeCtx.Apply(s.ctx)
+		if err := s.repo.CreateTransfer(transfer); err != nil {
+			return err
+		}
+	}
+
+	if err := s.linkTransfers(start); err != nil {
+		return err
+	}
+
+	s.ctx.Portfolio.TransferCursor = end.Add(-transferOverlap).UnixMilli()
+	return s.repo.UpdatePortfolio(s.ctx.Portfolio)
+}
+
+// valueTransfers values transfers stored before their asset had a price.
+func (s *portfolioScraper) valueTransfers() error {
+	transfers, err := s.repo.GetUnvaluedTransfers(s.ctx.Portfolio)
+	if err != nil {
+		return err
+	}
+
+	for _, transfer := range transfers {
+		quoteAmount, err := s.quoteValue(transfer.Asset, transfer.Amount, transfer.Date)
+		if err != nil {
+			return err
+		}
+
+		if quoteAmount == nil {
+			continue
+		}
+
+		transfer.QuoteAmount = quoteAmount
+		transfer.Portfolio = s.ctx.Portfolio
+		if err := s.repo.CreateTransfer(transfer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkTransfers marks transfers of the portfolio since start internal when
+// another portfolio recorded the other side of them.
+func (s *portfolioScraper) linkTransfers(start int64) error {
+	transfers, err := s.repo.GetUnlinkedTransfers(s.ctx.Portfolio, start)
+	if err != nil {
+		return err
+	}
+
+	for _, transfer := range transfers {
+		counter, err := s.repo.GetCounterTransfer(transfer)
+		if err != nil {
+			return err
+		}
+
+		if counter == nil {
+			continue
+		}
+
+		if err := s.repo.LinkTransfers(transfer, counter); err != nil {
+			return err
+		}
+
+		s.logf("linked %s of %f %s to portfolio %s", transfer.Type, transfer.Amount, transfer.Asset, counter.PortfolioID)
+	}
+
+	return nil
+}
+
+// ScrapeBalance stores the wallet balance of every asset. Exchanges leave
+// out assets without a balance, so assets held before that are left out
+// are stored as drained.
+func (s *portfolioScraper) ScrapeBalance(ctx context.Context) error {
+	s.logf("scraping balance")
+
+	date := time.Now().UTC()
+	balances, err := s.exchange.GetBalance(ctx)
+	if err != nil {
+		return err
+	}
+
+	held, err := s.repo.GetCurrentBalances(s.ctx.Portfolio)
+	if err != nil {
+		return err
+	}
+
+	for _, balance := range held {
+		if _, ok := balances[balance.Asset]; !ok && balance.AssetBalance != 0 {
+			balances[balance.Asset] = 0
+		}
+	}
+
+	for asset, assetBalance := range balances {
+		if err := s.saveBalance(asset, assetBalance, date); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveBalance stores the wallet balance of the asset as the current
+// balance and the balance of its day. Assets without a price are stored
+// with their balance in the asset only, valued at 0 in model.QuoteAsset.
+func (s *portfolioScraper) saveBalance(asset string, assetBalance float64, date time.Time) error {
+	quoteBalance, err := s.quoteValue(asset, assetBalance, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	var balance float64
+	if quoteBalance != nil {
+		balance = *quoteBalance
+	}
+
+	dailyBalance := &model.DailyBalance{
+		Asset:        asset,
+		AssetBalance: assetBalance,
+		Balance:      balance,
+		Date:         date.Truncate(time.Hour * 24),
+	}
+
+	dailyBalance.ScrapeCtx.Apply(s.ctx)
+	if err := s.repo.CreateDailyBalance(dailyBalance); err != nil {
+		return err
+	}
+
+	currentBalance := &model.CurrentBalance{
+		Asset:        asset,
+		AssetBalance: assetBalance,
+		Balance:      balance,
+		Date:         date,
+	}
+
+	currentBalance.ScrapeCtx.Apply(s.ctx)
+	return s.repo.UpdateCurrentBalance(currentBalance)
+}
+
+// ScrapeAccount stores a snapshot of the margin state of the account and
+// its assets. Accounts the exchange has no figures for, as every asset is
+// margined on its own, are summed from their assets in model.QuoteAsset.
+func (s *portfolioScraper) ScrapeAccount(ctx context.Context) error {
+	s.logf("scraping account")
+
+	snapshot, err := s.account.GetAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	date := time.Now().UTC()
+	snapshot.ScrapeCtx.Apply(s.ctx)
+	snapshot.Date = date
+	for _, asset := range snapshot.Assets {
+		asset.ScrapeCtx.Apply(s.ctx)
+		asset.Date = date
+	}
+
+	if snapshot.Asset == "" {
+		if err := s.sumAccount(snapshot); err != nil {
+			return err
+		}
+	}
+
+	if ratio := snapshot.MarginRatio(); ratio >= marginRatioWarning {
+		s.logf("margin ratio at %.1f%%", ratio*100)
+	}
+
+	for _, asset := range snapshot.Assets {
+		if ratio := asset.MarginRatio(); ratio >= marginRatioWarning {
+			s.logf("%s margin ratio at %.1f%%", asset.Asset, ratio*100)
+		}
+	}
+
+	return s.repo.CreateAccountSnapshot(snapshot)
+}
+
+func (s *portfolioScraper) sumAccount(snapshot *model.AccountSnapshot) error {
+	snapshot.Asset = model.QuoteAsset
+	for _, asset := range snapshot.Assets {
+		rate, err := s.toQuote(asset.Asset, 1)
+		if err != nil {
+			return err
+		}
+
+		snapshot.WalletBalance += asset.WalletBalance * rate
+		snapshot.UnrealizedPnl += asset.UnrealizedPnl * rate
+		snapshot.MarginBalance += asset.MarginBalance * rate
+		snapshot.AvailableBalance += asset.AvailableBalance * rate
+		snapshot.InitialMargin += asset.InitialMargin * rate
+		snapshot.MaintMargin += asset.MaintMargin * rate
+	}
+
+	return nil
+}
+
+// toQuote values the amount of the asset in model.QuoteAsset using the
+// latest symbol prices.
+func (s *portfolioScraper) toQuote(asset string, amount float64) (float64, error) {
+	return s.toQuoteAt(asset, amount, time.Time{})
+}
+
+// toQuoteAt values the amount of the asset in model.QuoteAsset at the
+// price it had at the given time, preferring prices of the portfolio's
+// exchange. Assets without a price fail with a valuation.NoPriceError,
+// rather than being added up as if they were QuoteAsset.
+func (s *portfolioScraper) toQuoteAt(asset string, amount float64, at time.Time) (float64, error) {
+	return s.converter.Convert(amount, asset, model.QuoteAsset, s.ctx.Portfolio.Exchange, at)
+}
+
+// quoteValue values the amount like toQuoteAt, but returns nil for assets
+// without a price, so records of them can be stored and valued later.
+func (s *portfolioScraper) quoteValue(asset string, amount float64, at time.Time) (*float64, error) {
+	value, err := s.toQuoteAt(asset, amount, at)
+	if errors.As(err, new(*valuation.NoPriceError)) {
+		if !s.unpriced[asset] {
+			s.unpriced[asset] = true
+			s.logf("%v, valuing it later", err)
+		}
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &value, nil
+}
+
+func (s *portfolioScraper) logf(format string, args ...interface{}) {
+	log.Printf("[%s] "+format, append([]interface{}{s.ctx.Portfolio.ID}, args...)...)
+}
@@ -0,0 +1,53 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper/exchange"
+)
+
+// retry runs the task, retrying it up to config.RetryAttempts times while
+// it fails with a transient error. Tasks resume from their cursors, so a
+// retry picks up where the failed attempt stopped. It returns the attempts
+// made.
+func retry(ctx context.Context, name string, run func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || attempt > config.RetryAttempts || !exchange.IsTransient(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		wait := retryBackoff(attempt)
+		log.Printf("%s failed, retrying in %v: %v", name, wait.Round(time.Millisecond), err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryBackoff returns how long to wait after the failed attempt. The
+// backoff starts at config.RetryBackoff and doubles with every attempt up
+// to config.RetryMaxBackoff, and a random part of it is left out, so
+// portfolios failing at the same time do not retry at the same time.
+func retryBackoff(attempt int) time.Duration {
+	backoff := config.RetryBackoff
+	for i := 1; i < attempt && backoff < config.RetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > config.RetryMaxBackoff {
+		backoff = config.RetryMaxBackoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
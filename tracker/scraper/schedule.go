@@ -0,0 +1,311 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper/exchange"
+)
+
+// marketTasks are the market data tasks, run through one portfolio of
+// every exchange that supports them, in the order they run.
+var marketTasks = []struct {
+	name       string
+	capability exchange.Capability
+	run        func(s *scraper, ctx context.Context, repo repository.Repository, scrapeCtx *model.ScrapeCtx) error
+}{
+	{"symbols", exchange.CapabilitySymbols, (*scraper).updateSymbols},
+	{"prices", exchange.CapabilityPrices, (*scraper).scrapePrices},
+}
+
+// job is a scrape task run on its own schedule. Jobs of the same lane, the
+// tasks of a portfolio or the market data tasks of an exchange, never run
+// at the same time.
+type job struct {
+	lane      string
+	task      string
+	market    bool
+	portfolio *model.Portfolio
+	interval  time.Duration
+	next      time.Time
+}
+
+// start schedules the first run of the job, offset into its interval from
+// now by a hash of the job, so jobs of the same interval are spread out
+// instead of all starting at once.
+func (j *job) start(now time.Time) {
+	j.next = now.Add(phase(j.lane+"/"+j.task, j.interval))
+}
+
+// advance moves the next run of the job past now, skipping the runs it
+// missed while its lane was busy.
+func (j *job) advance(now time.Time) {
+	if j.next.After(now) {
+		return
+	}
+
+	missed := now.Sub(j.next) / j.interval
+	j.next = j.next.Add((missed + 1) * j.interval)
+}
+
+// newJobs creates a job for every market data task of every exchange and
+// every task of every portfolio the exchange supports. The jobs are not
+// scheduled until they are started.
+func newJobs(portfolios []*model.Portfolio) ([]*job, error) {
+	if err := validateTaskIntervals(config.TaskIntervals); err != nil {
+		return nil, err
+	}
+
+	var jobs []*job
+	add := func(lane, task string, market bool, portfolio *model.Portfolio, intervals map[string]time.Duration) {
+		interval := taskInterval(intervals, task)
+		jobs = append(jobs, &job{
+			lane:      lane,
+			task:      task,
+			market:    market,
+			portfolio: portfolio,
+			interval:  interval,
+		})
+	}
+
+	for _, task := range marketTasks {
+		for _, portfolio := range marketPortfolios(portfolios, task.capability) {
+			intervals := config.ParseTaskIntervals(portfolio.TaskIntervals)
+			add("market "+portfolio.Exchange, task.name, true, portfolio, intervals)
+		}
+	}
+
+	for _, portfolio := range portfolios {
+		intervals := config.ParseTaskIntervals(portfolio.TaskIntervals)
+		if err := validateTaskIntervals(intervals); err != nil {
+			return nil, fmt.Errorf("portfolio %s: %v", portfolio.ID, err)
+		}
+
+		def := exchange.Lookup(portfolio.Exchange)
+		if def == nil {
+			log.Printf("[%s] not scheduled, unsupported exchange: %s", portfolio.ID, portfolio.Exchange)
+			continue
+		}
+
+		for _, task := range portfolioTasks {
+			if def.Supports(task.capability) {
+				add(portfolioLane(portfolio), task.name, false, portfolio, intervals)
+			}
+		}
+	}
+
+	return jobs, nil
+}
+
+// validateTaskIntervals fails for intervals of tasks that do not exist.
+func validateTaskIntervals(intervals map[string]time.Duration) error {
+	known := map[string]bool{}
+	for _, task := range marketTasks {
+		known[task.name] = true
+	}
+	for _, task := range portfolioTasks {
+		known[task.name] = true
+	}
+
+	for task := range intervals {
+		if !known[task] {
+			return fmt.Errorf("unknown task in task intervals: %s", task)
+		}
+	}
+
+	return nil
+}
+
+// taskInterval returns how often the task runs: at the interval of the
+// portfolio if it lists one, else at the configured one, else every
+// config.ScrapeInterval, or symbolsInterval for symbols.
+func taskInterval(portfolioIntervals map[string]time.Duration, task string) time.Duration {
+	if interval, ok := portfolioIntervals[task]; ok {
+		return interval
+	}
+
+	if interval, ok := config.TaskIntervals[task]; ok {
+		return interval
+	}
+
+	if task == "symbols" {
+		return symbolsInterval
+	}
+
+	if config.ScrapeInterval > 0 {
+		return config.ScrapeInterval
+	}
+
+	return config.DefaultScrapeInterval
+}
+
+// phase returns how far into its interval a job first runs, derived from
+// its key so it stays the same across restarts.
+func phase(key string, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// portfolioLane returns the lane the tasks of the portfolio run in.
+func portfolioLane(portfolio *model.Portfolio) string {
+	return "portfolio " + string(portfolio.ID)
+}
+
+// lockLane waits until no other task of the lane runs, and holds the lane
+// until the returned function is called. The scheduler never runs a lane
+// twice at once, so this only waits for user data streams.
+func (s *scraper) lockLane(lane string) func() {
+	s.mu.Lock()
+	mu, ok := s.lanes[lane]
+	if !ok {
+		mu = &sync.Mutex{}
+		s.lanes[lane] = mu
+	}
+	s.mu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// runSchedule runs the jobs as they become due, until ctx is done. Due
+// jobs of a lane run together as one scrape run, and jobs of a lane that
+// is still running wait for it, so no task overlaps another task of its
+// portfolio or exchange. At most config.ScrapeWorkers lanes run at once.
+// Once ctx is done, it waits for running lanes to wind down.
+func (s *scraper) runSchedule(ctx context.Context, jobs []*job) error {
+	workers := config.ScrapeWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	running := map[string]bool{}
+	done := make(chan string)
+	for {
+		now := time.Now()
+
+		var lanes []string
+		var wake time.Time
+		due := map[string][]*job{}
+		for _, jb := range jobs {
+			if running[jb.lane] {
+				continue
+			}
+
+			if jb.next.After(now) {
+				if wake.IsZero() || jb.next.Before(wake) {
+					wake = jb.next
+				}
+				continue
+			}
+
+			if due[jb.lane] == nil {
+				lanes = append(lanes, jb.lane)
+			}
+			due[jb.lane] = append(due[jb.lane], jb)
+		}
+
+		for _, lane := range lanes {
+			if len(running) >= workers {
+				break
+			}
+
+			for _, jb := range due[lane] {
+				jb.advance(now)
+			}
+
+			running[lane] = true
+			go func(lane string, jobs []*job) {
+				unlock := s.lockLane(lane)
+				s.runJobs(ctx, jobs)
+				unlock()
+				done <- lane
+			}(lane, due[lane])
+		}
+
+		var timer *time.Timer
+		var wakeC <-chan time.Time
+		if !wake.IsZero() && len(running) < workers {
+			timer = time.NewTimer(time.Until(wake))
+			wakeC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			for len(running) > 0 {
+				delete(running, <-done)
+			}
+			return ctx.Err()
+		case lane := <-done:
+			delete(running, lane)
+		case <-wakeC:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// runJobs runs due jobs of a lane as one scrape run. Failures are logged
+// and journaled, and the run only fails as a whole when ctx is done.
+func (s *scraper) runJobs(ctx context.Context, jobs []*job) {
+	j, err := startJournal(s.repo)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer func() { j.finish(ctx.Err()) }()
+
+	tasks := make([]string, 0, len(jobs))
+	for _, jb := range jobs {
+		tasks = append(tasks, jb.task)
+	}
+
+	portfolio := jobs[0].portfolio
+	if jobs[0].market {
+		s.runMarketTasks(ctx, j, portfolio, tasks)
+		return
+	}
+
+	if err := s.scrapeWithBreaker(ctx, j, portfolio, tasks...); err != nil && ctx.Err() == nil {
+		log.Print(fmt.Errorf("portfolio %s: %v", portfolio.Alias, err))
+	}
+}
+
+// runMarketTasks runs the named market data tasks of the exchange of the
+// portfolio, in the order of marketTasks.
+func (s *scraper) runMarketTasks(ctx context.Context, j *journal, portfolio *model.Portfolio, tasks []string) {
+	selected := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		selected[task] = true
+	}
+
+	for _, task := range marketTasks {
+		if !selected[task.name] || ctx.Err() != nil {
+			continue
+		}
+
+		run := task.run
+		err := s.runMarketTask(ctx, j, portfolio, task.name, func(ctx context.Context, repo repository.Repository, scrapeCtx *model.ScrapeCtx) error {
+			return run(s, ctx, repo, scrapeCtx)
+		})
+		if err != nil {
+			log.Print(fmt.Errorf("%s from %s: %v", task.name, portfolio.Exchange, err))
+			continue
+		}
+
+		if task.name == "symbols" {
+			if err := s.warnDelistingPositions(); err != nil {
+				log.Print(fmt.Errorf("delisting positions: %v", err))
+			}
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package scraper
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/sarmerer/go-crypto-dashboard/config"
@@ -12,41 +14,47 @@ import (
 )
 
 type Scraper interface {
-	GetExchange(portfolio *model.Portfolio) (exchange.Exchange, error)
-
-	Scrape() error
-	ContinuousScrape() error
-	ScrapePrices(portfolio *model.Portfolio) error
-	ScrapePortfolio(portfolio *model.Portfolio) error
-	ScrapePositions() error
-	ScrapeOrders() error
-	ScrapeIncome() error
-	ScrapeBalance() error
-
-	IsWeightOverused() bool
-	WaitWeightCooldown()
-	Sleep(d time.Duration)
+	GetExchange(ctx context.Context, scrapeCtx *model.ScrapeCtx) (exchange.Exchange, error)
+
+	Scrape(ctx context.Context) error
+	ContinuousScrape(ctx context.Context) error
+	ScrapePrices(ctx context.Context, portfolio *model.Portfolio) error
+	ScrapeSymbols(ctx context.Context, portfolio *model.Portfolio) error
+	ScrapePortfolio(ctx context.Context, portfolio *model.Portfolio) error
+	StreamPortfolio(ctx context.Context, portfolio *model.Portfolio) error
+
+	Sleep(ctx context.Context, d time.Duration) error
 }
 
 type scraper struct {
-	repo     repository.Repository
-	exchange exchange.Exchange
-	ctx      *model.ScrapeCtx
+	repo repository.Repository
+
+	mu      sync.Mutex
+	budgets map[string]*exchange.WeightBudget
+
+	// symbolsScrapedAt is when the symbols of each exchange were last
+	// scraped
+	symbolsScrapedAt map[string]time.Time
+
+	breakers map[model.PortfolioID]*model.PortfolioBreaker
+
+	// lanes are held while a lane runs, so writes of user data streams do
+	// not interleave with scheduled tasks of their portfolio
+	lanes map[string]*sync.Mutex
 }
 
 func NewScraper(repo repository.Repository) (Scraper, error) {
 	return &scraper{
-		ctx: &model.ScrapeCtx{
-			ScrapedAt:   time.Now().UnixMilli(),
-			WeightLimit: config.ExchangeWeightLimit,
-			Cooldown:    config.ExchangeWeightCooldown,
-		},
-		repo: repo,
+		repo:             repo,
+		budgets:          make(map[string]*exchange.WeightBudget),
+		symbolsScrapedAt: make(map[string]time.Time),
+		breakers:         make(map[model.PortfolioID]*model.PortfolioBreaker),
+		lanes:            make(map[string]*sync.Mutex),
 	}, nil
 }
 
-func (s *scraper) GetExchange(portfolio *model.Portfolio) (exchange.Exchange, error) {
-	exchange, err := exchange.NewExchange(portfolio, s.ctx)
+func (s *scraper) GetExchange(ctx context.Context, scrapeCtx *model.ScrapeCtx) (exchange.Exchange, error) {
+	exchange, err := exchange.NewExchange(ctx, scrapeCtx.Portfolio, scrapeCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +62,17 @@ func (s *scraper) GetExchange(portfolio *model.Portfolio) (exchange.Exchange, er
 	return exchange, nil
 }
 
-func (s *scraper) Scrape() (err error) {
+// Scrape scrapes market data and every portfolio once, and journals the
+// run and the outcome of every task. Once ctx is done, no other task is
+// started, and running portfolio tasks are given a while to finish before
+// they are cancelled too.
+func (s *scraper) Scrape(ctx context.Context) (err error) {
+	j, err := startJournal(s.repo)
+	if err != nil {
+		return err
+	}
+	defer func() { j.finish(err) }()
+
 	portfolios, err := config.GetPortfolios()
 	if err != nil {
 		return err
@@ -64,247 +82,282 @@ func (s *scraper) Scrape() (err error) {
 		return fmt.Errorf("no portfolios found")
 	}
 
-	if err := s.ScrapePrices(portfolios[0]); err != nil {
-		return err
-	}
+	s.scrapeSymbols(ctx, j, portfolios)
 
-	for _, portfolio := range portfolios {
-		if err := s.ScrapePortfolio(portfolio); err != nil {
-			log.Print(fmt.Errorf("portfolio %s: %v", portfolio.Alias, err))
-		}
+	pricePortfolios := marketPortfolios(portfolios, exchange.CapabilityPrices)
+	if len(pricePortfolios) == 0 {
+		log.Println("skipped prices, no portfolio exchange supports them")
 	}
 
-	return nil
-}
+	for _, portfolio := range pricePortfolios {
+		if ctx.Err() != nil {
+			break
+		}
 
-func (s *scraper) ContinuousScrape() error {
-	log.Println("continuous scraping started")
+		if err := s.runMarketTask(ctx, j, portfolio, "prices", s.scrapePrices); err != nil {
+			log.Print(fmt.Errorf("prices from %s: %v", portfolio.Exchange, err))
+		}
+	}
 
-	if err := s.Scrape(); err != nil {
-		return err
+	workers := config.ScrapeWorkers
+	if workers < 1 {
+		workers = 1
 	}
 
-	for {
-		d := config.ScrapeInterval
-		log.Printf("sleeping for %v", d)
-		s.divider()
-		s.Sleep(d)
+	queue := make(chan *model.Portfolio)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for portfolio := range queue {
+				if err := s.scrapeWithBreaker(ctx, j, portfolio); err != nil {
+					log.Print(fmt.Errorf("portfolio %s: %v", portfolio.Alias, err))
+				}
+			}
+		}()
+	}
 
-		if err := s.Scrape(); err != nil {
-			log.Println("failed to scrape:", err)
+enqueue:
+	for _, portfolio := range portfolios {
+		select {
+		case <-ctx.Done():
+			break enqueue
+		case queue <- portfolio:
 		}
 	}
-}
+	close(queue)
+	wg.Wait()
 
-func (s *scraper) ScrapePortfolio(portfolio *model.Portfolio) error {
-	err := s.repo.SyncPortfolio(portfolio)
-	if err != nil {
-		return err
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
-	s.ctx.Portfolio = portfolio
-	log.Printf("scraping portfolio: \"%s\"", s.ctx.Portfolio.ID)
+	if err := s.warnDelistingPositions(); err != nil {
+		log.Print(fmt.Errorf("delisting positions: %v", err))
+	}
+
+	return nil
+}
 
-	exchange, err := s.GetExchange(portfolio)
+// ContinuousScrape scrapes everything once, then runs every task on its
+// own schedule until ctx is done, and returns ctx.Err() then.
+func (s *scraper) ContinuousScrape(ctx context.Context) error {
+	log.Println("continuous scraping started")
+
+	portfolios, err := config.GetPortfolios()
 	if err != nil {
 		return err
 	}
-	s.exchange = exchange
 
-	if err := s.repo.RemoveAllPositions(portfolio); err != nil {
+	jobs, err := newJobs(portfolios)
+	if err != nil {
 		return err
 	}
 
-	if err := s.repo.RemoveAllOrders(portfolio); err != nil {
+	if err := s.Scrape(ctx); err != nil {
 		return err
 	}
 
-	tasks := []func() error{
-		s.ScrapeBalance,
-		s.ScrapePositions,
-		s.ScrapeOrders,
-		s.ScrapeIncome,
+	// the first runs are scheduled from the end of the full scrape, which
+	// may take longer than the shortest intervals
+	now := time.Now()
+	for _, jb := range jobs {
+		jb.start(now)
 	}
 
-	for _, task := range tasks {
-		if err := task(); err != nil {
+	if config.StreamUserData {
+		if err := s.startStreams(ctx); err != nil {
 			return err
 		}
-
-		if s.IsWeightOverused() {
-			s.WaitWeightCooldown()
-		}
 	}
 
 	s.divider()
-	return nil
+	return s.runSchedule(ctx, jobs)
 }
 
-func (s *scraper) ScrapePrices(portfolio *model.Portfolio) error {
-	log.Printf("scraping prices from %s\n", portfolio.Exchange)
-	s.divider()
-
-	exchange, err := s.GetExchange(portfolio)
-	if err != nil {
-		return err
-	}
+func (s *scraper) ScrapePortfolio(ctx context.Context, portfolio *model.Portfolio) error {
+	return s.scrapePortfolio(ctx, nil, portfolio)
+}
 
-	prices, err := exchange.GetSymbolPrices()
-	if err != nil {
-		return err
-	}
+// scrapePortfolio scrapes the named tasks of the portfolio, or all of them
+// when none are named.
+func (s *scraper) scrapePortfolio(ctx context.Context, j *journal, portfolio *model.Portfolio, tasks ...string) error {
+	scrapeCtx := s.newScrapeCtx(portfolio)
+	log.Printf("scraping portfolio: \"%s\"", portfolio.ID)
 
-	for _, price := range prices {
-		price.ScrapeCtx.Apply(s.ctx)
-		if err := s.repo.CreateSymbolPrice(price); err != nil {
+	var e exchange.Exchange
+	err := j.record(ctx, scrapeCtx, newCountingRepo(s.repo), "connect", func() error {
+		if err := s.repo.SyncPortfolio(portfolio); err != nil {
 			return err
 		}
+
+		var err error
+		e, err = s.GetExchange(ctx, scrapeCtx)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
+	ps := newPortfolioScraper(s.repo, e, scrapeCtx)
+	ps.journal = j
+	return ps.Scrape(ctx, tasks...)
 }
 
-func (s *scraper) ScrapePositions() error {
-	log.Println("scraping positions")
-
-	positions, err := s.exchange.GetPositions()
+// startStreams streams the user data of every portfolio whose exchange
+// supports it, beside the scrapes.
+func (s *scraper) startStreams(ctx context.Context) error {
+	portfolios, err := config.GetPortfolios()
 	if err != nil {
 		return err
 	}
 
-	for _, position := range positions {
-		position.ScrapeCtx.Apply(s.ctx)
-		if err := s.repo.CreatePosition(position); err != nil {
-			return err
+	for _, portfolio := range portfolios {
+		def := exchange.Lookup(portfolio.Exchange)
+		if def == nil || !def.Supports(exchange.CapabilityUserData) {
+			continue
 		}
 
+		go func(portfolio *model.Portfolio) {
+			if err := s.StreamPortfolio(ctx, portfolio); err != nil {
+				log.Print(fmt.Errorf("stream of portfolio %s: %v", portfolio.Alias, err))
+			}
+		}(portfolio)
 	}
 
 	return nil
 }
 
-func (s *scraper) ScrapeOrders() error {
-	log.Println("scraping orders")
-
-	orders, err := s.exchange.GetOrders()
-	if err != nil {
-		return err
-	}
+func (s *scraper) ScrapePrices(ctx context.Context, portfolio *model.Portfolio) error {
+	return s.runMarketTask(ctx, nil, portfolio, "prices", s.scrapePrices)
+}
 
-	for _, order := range orders {
-		order.ScrapeCtx.Apply(s.ctx)
-		if err := s.repo.CreateOrder(order); err != nil {
-			return err
-		}
-	}
+// runMarketTask runs a market data task through the portfolio, recording
+// it in the journal.
+func (s *scraper) runMarketTask(ctx context.Context, j *journal, portfolio *model.Portfolio, task string, run func(ctx context.Context, repo repository.Repository, scrapeCtx *model.ScrapeCtx) error) error {
+	scrapeCtx := s.newScrapeCtx(portfolio)
+	repo := newCountingRepo(s.repo)
 
-	return nil
+	return j.record(ctx, scrapeCtx, repo, task, func() error {
+		return run(ctx, repo, scrapeCtx)
+	})
 }
 
-func (s *scraper) ScrapeIncome() error {
-	if config.ScrapeHistory && !s.ctx.Portfolio.HistoryScraped {
-		return s.scrapeIncomeHistory()
-	}
-
-	log.Println("scraping recent income")
+func (s *scraper) scrapePrices(ctx context.Context, repo repository.Repository, scrapeCtx *model.ScrapeCtx) error {
+	portfolio := scrapeCtx.Portfolio
+	log.Printf("scraping prices from %s\n", portfolio.Exchange)
 
-	incomes, err := s.exchange.GetIncome()
+	e, err := s.GetExchange(ctx, scrapeCtx)
 	if err != nil {
 		return err
 	}
 
-	for _, income := range incomes {
-		income.ScrapeCtx.Apply(s.ctx)
-		if err := s.repo.CreateIncome(income); err != nil {
-			return err
-		}
+	reader, ok := e.(exchange.PriceReader)
+	if !ok {
+		return fmt.Errorf("%s does not support prices", portfolio.Exchange)
 	}
 
-	return nil
-}
-
-func (s *scraper) scrapeIncomeHistory() error {
-	log.Println("scraping historical income")
+	prices, err := reader.GetSymbolPrices(ctx)
+	if err != nil {
+		return err
+	}
 
-	oldestIncomeTime := time.Now().UnixMilli()
-	for {
-		if s.IsWeightOverused() {
-			s.WaitWeightCooldown()
-			log.Println("scraping next chunk...")
-		}
+	date := time.UnixMilli(scrapeCtx.ScrapedAt).UTC().Truncate(config.PriceResolution)
+	samples := make([]*model.PriceSample, 0, len(prices))
+	for _, price := range prices {
+		price.ScrapeCtx.Apply(scrapeCtx)
+		price.Exchange = portfolio.Exchange
+
+		samples = append(samples, &model.PriceSample{
+			Exchange: price.Exchange,
+			Symbol:   price.Symbol,
+			Date:     date,
+			Price:    price.Price,
+		})
+	}
 
-		incomes, err := s.exchange.GetIncomeBetween(0, oldestIncomeTime)
-		if err != nil {
-			return err
-		}
+	if err := repo.CreateSymbolPrices(prices); err != nil {
+		return err
+	}
 
-		if len(incomes) == 0 {
-			break
-		}
+	return repo.CreatePriceSamples(samples)
+}
 
-		for _, income := range incomes {
-			income.ScrapeCtx.Apply(s.ctx)
-			if err := s.repo.CreateIncome(income); err != nil {
-				return err
-			}
+// marketPortfolios returns, for every exchange that declares the
+// capability, the first portfolio using it. Market data is the same for all
+// portfolios of an exchange, so it is scraped once through that portfolio.
+func marketPortfolios(portfolios []*model.Portfolio, capability exchange.Capability) []*model.Portfolio {
+	var result []*model.Portfolio
+	seen := map[string]bool{}
+	for _, portfolio := range portfolios {
+		if seen[portfolio.Exchange] {
+			continue
 		}
 
-		newOldest := incomes[0].Date.UnixMilli()
-		if newOldest >= oldestIncomeTime {
-			break
+		def := exchange.Lookup(portfolio.Exchange)
+		if def != nil && def.Supports(capability) {
+			seen[portfolio.Exchange] = true
+			result = append(result, portfolio)
 		}
-
-		oldestIncomeTime = newOldest - 1
 	}
 
-	s.ctx.Portfolio.HistoryScraped = true
-	if err := s.repo.UpdatePortfolio(s.ctx.Portfolio); err != nil {
-		return err
-	}
-
-	return nil
+	return result
 }
 
-func (s *scraper) ScrapeBalance() error {
-	log.Println("scraping balance")
+// Sleep waits for d, or until ctx is done and returns ctx.Err().
+func (s *scraper) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	date := time.Now().UTC()
-	balance, err := s.exchange.GetBalance()
-	if err != nil {
-		return err
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
+}
 
-	dailyBalance := &model.DailyBalance{
-		Balance: balance,
-		Date:    date.Truncate(time.Hour * 24),
+// newScrapeCtx creates an isolated scrape context for the portfolio,
+// sharing the weight budget with other portfolios using the same API key.
+func (s *scraper) newScrapeCtx(portfolio *model.Portfolio) *model.ScrapeCtx {
+	return &model.ScrapeCtx{
+		ScrapedAt:   time.Now().UnixMilli(),
+		Portfolio:   portfolio,
+		PortfolioID: portfolio.ID,
+		Weight:      s.getWeightBudget(portfolio.Exchange, portfolio.APIKey),
 	}
+}
 
-	dailyBalance.ScrapeCtx.Apply(s.ctx)
-	if err := s.repo.CreateDailyBalance(dailyBalance); err != nil {
-		return err
+// getWeightBudget returns the weight budget shared by portfolios of the
+// exchange with the same API key. Weight is counted per exchange, as each
+// has limits and weight units of its own.
+func (s *scraper) getWeightBudget(exchangeName, apiKey string) *exchange.WeightBudget {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := exchangeName + "/" + apiKey
+	budget, ok := s.budgets[key]
+	if !ok {
+		budget = exchange.NewWeightBudget(weightLimit(exchangeName))
+		s.budgets[key] = budget
 	}
 
-	currentBalance := &model.CurrentBalance{Balance: balance, Date: date}
-	currentBalance.ScrapeCtx.Apply(s.ctx)
-	if err := s.repo.UpdateCurrentBalance(currentBalance); err != nil {
-		return err
-	}
-
-	return nil
+	return budget
 }
 
-func (s *scraper) IsWeightOverused() bool {
-	return s.ctx.WeightUsed > s.ctx.WeightLimit
-}
+// weightLimit returns the weight limit of the exchange set in the config,
+// or else the limit of its adapter.
+func weightLimit(exchangeName string) int32 {
+	if limit := config.ExchangeWeightLimits[exchangeName]; limit > 0 {
+		return limit
+	}
 
-func (s *scraper) WaitWeightCooldown() {
-	log.Printf("used weight: %d/%d, sleeping for %v seconds", s.ctx.WeightUsed, s.ctx.WeightLimit, s.ctx.Cooldown)
-	s.Sleep(s.ctx.Cooldown)
-	s.ctx.WeightUsed = 0
-}
+	if def := exchange.Lookup(exchangeName); def != nil && def.WeightLimit > 0 {
+		return def.WeightLimit
+	}
 
-func (s *scraper) Sleep(d time.Duration) {
-	time.Sleep(d)
+	return config.DefaultExcWeightLimit
 }
 
 func (s *scraper) divider() {
@@ -0,0 +1,189 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper/exchange"
+)
+
+// streamReconnectDelay is how long a dropped user data stream waits before
+// reconnecting.
+const streamReconnectDelay = 5 * time.Second
+
+// StreamPortfolio keeps the positions, balances and orders of the
+// portfolio up to date from the user data stream of its exchange, until
+// ctx is done. The stream reconnects whenever it drops, and every time it
+// connects they are resynced, as changes made while it was down are lost.
+//
+// Streams failing to connect count against the circuit breaker of the
+// portfolio like failed scrapes, and are not reconnected while it is open.
+// Resyncs and updates hold the lane of the portfolio, so they never run
+// alongside its scheduled tasks.
+func (s *scraper) StreamPortfolio(ctx context.Context, portfolio *model.Portfolio) error {
+	def := exchange.Lookup(portfolio.Exchange)
+	if def == nil || !def.Supports(exchange.CapabilityUserData) {
+		return fmt.Errorf("%s does not support user data streams", portfolio.Exchange)
+	}
+
+	if err := s.repo.SyncPortfolio(portfolio); err != nil {
+		return err
+	}
+
+	breaker, err := s.getBreaker(portfolio)
+	if err != nil {
+		return err
+	}
+
+	for {
+		delay := streamReconnectDelay
+		if retryAt, ok := s.allowBreaker(portfolio, breaker); ok {
+			connected := false
+			err := s.streamPortfolio(ctx, portfolio, func() { connected = true })
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// a stream that connected says the account can be reached, no
+			// matter why it dropped later
+			if connected {
+				s.recordBreaker(portfolio, breaker, nil)
+			} else {
+				s.recordBreaker(portfolio, breaker, err)
+			}
+
+			log.Printf("[%s] user data stream dropped: %v", portfolio.ID, err)
+		} else {
+			log.Printf("[%s] user data stream paused, circuit breaker open until %s", portfolio.ID, retryAt.Format(time.RFC3339))
+			delay = time.Until(retryAt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// streamPortfolio streams the user data of the portfolio until the stream
+// drops, calling subscribed once it is connected.
+func (s *scraper) streamPortfolio(ctx context.Context, portfolio *model.Portfolio, subscribed func()) error {
+	scrapeCtx := s.newScrapeCtx(portfolio)
+	e, err := s.GetExchange(ctx, scrapeCtx)
+	if err != nil {
+		return err
+	}
+
+	streamer, ok := e.(exchange.UserDataStreamer)
+	if !ok {
+		return fmt.Errorf("%s does not support user data streams", portfolio.Exchange)
+	}
+
+	ps := newPortfolioScraper(s.repo, e, scrapeCtx)
+	lane := portfolioLane(portfolio)
+	connected := func() error {
+		subscribed()
+
+		defer s.lockLane(lane)()
+		return ps.resync(ctx)
+	}
+	handle := func(event *exchange.UserDataEvent) error {
+		defer s.lockLane(lane)()
+		return ps.handleUserData(ctx, event)
+	}
+	return streamer.StreamUserData(ctx, connected, handle)
+}
+
+// resync scrapes the state the user data stream keeps up to date.
+func (s *portfolioScraper) resync(ctx context.Context) error {
+	s.logf("user data stream connected, resyncing")
+
+	return s.runTasks(ctx, []scrapeTask{
+		{"balance", exchange.CapabilityBalance, s.ScrapeBalance},
+		{"positions", exchange.CapabilityPositions, s.ScrapePositions},
+		{"orders", exchange.CapabilityOrders, s.ScrapeOrders},
+	})
+}
+
+func (s *portfolioScraper) handleUserData(ctx context.Context, event *exchange.UserDataEvent) error {
+	s.ctx.ScrapedAt = time.Now().UnixMilli()
+
+	for asset, balance := range event.Balances {
+		if err := s.saveBalance(asset, balance, event.Date.UTC()); err != nil {
+			return err
+		}
+	}
+
+	for _, position := range event.Positions {
+		if err := s.savePosition(position); err != nil {
+			return err
+		}
+	}
+
+	if event.Order != nil {
+		if err := s.saveStreamedOrder(ctx, event.Order); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveStreamedOrder stores an order update. Streams may leave out the time
+// the order was placed, which is then kept from the stored order, or read
+// from the exchange for orders placed while the stream was down.
+func (s *portfolioScraper) saveStreamedOrder(ctx context.Context, order *model.Order) error {
+	if order.Date.IsZero() {
+		stored, err := s.repo.GetOrder(s.ctx.Portfolio, order.Symbol, order.ID)
+		if err != nil {
+			return err
+		}
+
+		if stored == nil && s.orders != nil {
+			stored, err = s.orders.GetOrder(ctx, order)
+			if err != nil {
+				return fmt.Errorf("order %d: %v", order.ID, err)
+			}
+		}
+
+		if stored != nil {
+			order.Date = stored.Date
+		}
+	}
+
+	order.KeyedScrapeCtx.Apply(s.ctx)
+	return s.repo.CreateOrder(order)
+}
+
+// savePosition replaces the stored position with a streamed one. Streams
+// may leave out leverage and margin, which are then kept from the stored
+// position.
+func (s *portfolioScraper) savePosition(position *model.Position) error {
+	position.ScrapeCtx.Apply(s.ctx)
+
+	if position.Leverage == 0 {
+		stored, err := s.repo.GetPosition(s.ctx.Portfolio, position.Symbol, position.Side)
+		if err != nil {
+			return err
+		}
+
+		if stored != nil {
+			position.Leverage = stored.Leverage
+		}
+	}
+
+	if position.Cost == 0 && position.Leverage > 0 {
+		position.Cost = math.Abs(position.Amount) * position.EntryPrice / float64(position.Leverage)
+	}
+
+	if err := s.repo.ReplacePosition(position); err != nil {
+		return err
+	}
+
+	return s.repo.CreatePositionSnapshot(model.NewPositionSnapshot(position))
+}
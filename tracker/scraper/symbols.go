@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/scraper/exchange"
+)
+
+// symbolsInterval is how often the symbols of an exchange are scraped.
+// Trading rules and listings rarely change, and exchanges announce
+// delistings days ahead.
+const symbolsInterval = 6 * time.Hour
+
+// scrapeSymbols scrapes the symbols of every exchange that supports them
+// and was not scraped within symbolsInterval.
+func (s *scraper) scrapeSymbols(ctx context.Context, j *journal, portfolios []*model.Portfolio) {
+	for _, portfolio := range marketPortfolios(portfolios, exchange.CapabilitySymbols) {
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		scrapedAt := s.symbolsScrapedAt[portfolio.Exchange]
+		s.mu.Unlock()
+
+		if time.Since(scrapedAt) < symbolsInterval {
+			continue
+		}
+
+		if err := s.runMarketTask(ctx, j, portfolio, "symbols", s.updateSymbols); err != nil {
+			log.Print(fmt.Errorf("symbols from %s: %v", portfolio.Exchange, err))
+			continue
+		}
+
+		s.mu.Lock()
+		s.symbolsScrapedAt[portfolio.Exchange] = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// ScrapeSymbols replaces the symbols stored for the exchange of the
+// portfolio. Symbols the exchange no longer lists are marked delisted.
+func (s *scraper) ScrapeSymbols(ctx context.Context, portfolio *model.Portfolio) error {
+	return s.runMarketTask(ctx, nil, portfolio, "symbols", s.updateSymbols)
+}
+
+func (s *scraper) updateSymbols(ctx context.Context, repo repository.Repository, scrapeCtx *model.ScrapeCtx) error {
+	portfolio := scrapeCtx.Portfolio
+	log.Printf("scraping symbols from %s\n", portfolio.Exchange)
+
+	e, err := s.GetExchange(ctx, scrapeCtx)
+	if err != nil {
+		return err
+	}
+
+	reader, ok := e.(exchange.SymbolInfoReader)
+	if !ok {
+		return fmt.Errorf("%s does not support symbols", portfolio.Exchange)
+	}
+
+	infos, err := reader.GetSymbolInfos(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		info.Exchange = portfolio.Exchange
+		info.ScrapedAt = scrapeCtx.ScrapedAt
+	}
+
+	return repo.UpdateSymbolInfos(portfolio.Exchange, infos)
+}
+
+// warnDelistingPositions logs the open positions in symbols that are being
+// delisted, as the exchange will close them.
+func (s *scraper) warnDelistingPositions() error {
+	positions, err := s.repo.GetDelistingPositions()
+	if err != nil {
+		return err
+	}
+
+	for _, position := range positions {
+		log.Printf("portfolio \"%s\" holds %s %s, which is being delisted", position.PortfolioID, position.Side, position.Symbol)
+	}
+
+	return nil
+}
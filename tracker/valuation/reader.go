@@ -0,0 +1,209 @@
+package valuation
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/config"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+)
+
+// reader is a repository reader that fills in the Normalized value of the
+// income, transfers and daily balances it returns, and returns net
+// deposits in the reporting currency.
+type reader struct {
+	repository.Reader
+
+	converter Converter
+	currency  string
+}
+
+// NewReader wraps the repository reader to normalize the figures it
+// returns into the currency, at the prices of the time they are dated.
+func NewReader(repo repository.Reader, currency string) repository.Reader {
+	return &reader{
+		Reader:    repo,
+		converter: NewConverter(repo),
+		currency:  currency,
+	}
+}
+
+func (r *reader) GetIncomeBetween(start, end int64) ([]*model.Income, error) {
+	incomes, err := r.Reader.GetIncomeBetween(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return incomes, r.normalizeIncome(incomes)
+}
+
+func (r *reader) GetPortfolioIncomeBetween(portfolio *model.Portfolio, start, end int64) ([]*model.Income, error) {
+	incomes, err := r.Reader.GetPortfolioIncomeBetween(portfolio, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return incomes, r.normalizeIncome(incomes)
+}
+
+func (r *reader) GetTransfersBetween(portfolio *model.Portfolio, start, end int64) ([]*model.Transfer, error) {
+	transfers, err := r.Reader.GetTransfersBetween(portfolio, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, r.normalizeTransfers(transfers)
+}
+
+func (r *reader) GetExternalTransfersBetween(start, end int64) ([]*model.Transfer, error) {
+	transfers, err := r.Reader.GetExternalTransfersBetween(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return transfers, r.normalizeTransfers(transfers)
+}
+
+func (r *reader) normalizeTransfers(transfers []*model.Transfer) error {
+	rates, err := r.newRates()
+	if err != nil {
+		return err
+	}
+
+	for _, transfer := range transfers {
+		if transfer.Normalized, err = rates.normalize(transfer.Amount, transfer.Asset, transfer.PortfolioID, transfer.Date); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *reader) GetDailyBalancesBetween(portfolio *model.Portfolio, start, end int64) ([]*model.DailyBalance, error) {
+	balances, err := r.Reader.GetDailyBalancesBetween(portfolio, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	rates, err := r.newRates()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, balance := range balances {
+		if balance.Normalized, err = rates.normalize(balance.AssetBalance, balance.Asset, balance.PortfolioID, balance.Date); err != nil {
+			return nil, err
+		}
+	}
+
+	return balances, nil
+}
+
+// GetNetDeposits values every transfer at the time it happened, rather
+// than summing the stored model.QuoteAsset values.
+func (r *reader) GetNetDeposits(portfolio *model.Portfolio, start, end int64) (float64, error) {
+	portfolios := []*model.Portfolio{portfolio}
+	if portfolio == nil {
+		var err error
+		if portfolios, err = r.Reader.GetPortfolios(); err != nil {
+			return 0, err
+		}
+	}
+
+	var total float64
+	for _, p := range portfolios {
+		transfers, err := r.GetTransfersBetween(p, start, end)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, transfer := range transfers {
+			// internal transfers cancel out across all portfolios
+			if portfolio == nil && transfer.Internal {
+				continue
+			}
+
+			total += transfer.Value
+		}
+	}
+
+	return total, nil
+}
+
+func (r *reader) normalizeIncome(incomes []*model.Income) error {
+	rates, err := r.newRates()
+	if err != nil {
+		return err
+	}
+
+	for _, income := range incomes {
+		if income.Normalized, err = rates.normalize(income.Income, income.Asset, income.PortfolioID, income.Date); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rates caches the rates of one read, as prices only change once per
+// price history resolution.
+type rates struct {
+	converter Converter
+	currency  string
+	exchanges map[model.PortfolioID]string
+	cache     map[rateKey]float64
+}
+
+type rateKey struct {
+	asset    string
+	exchange string
+	date     time.Time
+}
+
+func (r *reader) newRates() (*rates, error) {
+	portfolios, err := r.Reader.GetPortfolios()
+	if err != nil {
+		return nil, err
+	}
+
+	exchanges := make(map[model.PortfolioID]string, len(portfolios))
+	for _, portfolio := range portfolios {
+		exchanges[portfolio.ID] = portfolio.Exchange
+	}
+
+	return &rates{
+		converter: r.converter,
+		currency:  r.currency,
+		exchanges: exchanges,
+		cache:     map[rateKey]float64{},
+	}, nil
+}
+
+// normalize values the amount of the asset in the reporting currency.
+// Amounts of assets without a price are left without a currency, rather
+// than failing the whole read.
+func (r *rates) normalize(amount float64, asset string, portfolioID model.PortfolioID, at time.Time) (model.Normalized, error) {
+	if amount == 0 || asset == "" {
+		return model.Normalized{Currency: r.currency, Value: amount}, nil
+	}
+
+	key := rateKey{asset, r.exchanges[portfolioID], at.UTC().Truncate(config.PriceResolution)}
+	rate, ok := r.cache[key]
+	if !ok {
+		var err error
+		rate, err = r.converter.Rate(key.asset, r.currency, key.exchange, at)
+		if err != nil && !errors.As(err, new(*NoPriceError)) {
+			return model.Normalized{}, err
+		}
+
+		// a rate of 0 marks an asset without a price
+		r.cache[key] = rate
+	}
+
+	if rate == 0 {
+		return model.Normalized{}, nil
+	}
+
+	return model.Normalized{Currency: r.currency, Value: amount * rate}, nil
+}
@@ -0,0 +1,200 @@
+// Package valuation values amounts of any asset in another currency, at
+// the prices stored by the scraper.
+package valuation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sarmerer/go-crypto-dashboard/tracker/model"
+	"github.com/sarmerer/go-crypto-dashboard/tracker/repository"
+)
+
+// usd has no market of its own on the supported exchanges, QuoteAsset
+// stands in for it.
+const usd = "USD"
+
+// latestPriceAge is how long ago a time may be for the latest price to
+// value it at, when the price history does not reach back to it yet.
+const latestPriceAge = time.Hour
+
+// NoPriceError is returned when there is no price to value an asset in a
+// currency with.
+type NoPriceError struct {
+	Asset    string
+	Currency string
+}
+
+func (e *NoPriceError) Error() string {
+	return fmt.Sprintf("no price to value %s in %s", e.Asset, e.Currency)
+}
+
+type Converter interface {
+	// Convert values the amount of the asset in the currency at the given
+	// time, or at the latest prices if the time is zero. Prices of the
+	// exchange are preferred over those of other exchanges, which are used
+	// when it has no market for the asset. Exchange may be empty. Assets
+	// without a price, including at times the price history does not reach
+	// back to, fail with a NoPriceError.
+	Convert(amount float64, asset, currency, exchange string, at time.Time) (float64, error)
+
+	// Rate returns how much of the currency one unit of the asset is worth,
+	// the way Convert values it.
+	Rate(asset, currency, exchange string, at time.Time) (float64, error)
+}
+
+type converter struct {
+	repo repository.Reader
+}
+
+func NewConverter(repo repository.Reader) Converter {
+	return &converter{repo: repo}
+}
+
+func (c *converter) Convert(amount float64, asset, currency, exchange string, at time.Time) (float64, error) {
+	if amount == 0 || asset == "" {
+		return amount, nil
+	}
+
+	rate, err := c.Rate(asset, currency, exchange, at)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount * rate, nil
+}
+
+func (c *converter) Rate(asset, currency, exchange string, at time.Time) (float64, error) {
+	base, quote := canonical(asset), canonical(currency)
+	if base == quote {
+		return 1, nil
+	}
+
+	exchanges := []string{""}
+	if exchange != "" {
+		exchanges = []string{exchange, ""}
+	}
+
+	for _, exchange := range exchanges {
+		rate, err := c.rate(base, quote, exchange, at)
+		if err != nil {
+			return 0, err
+		}
+
+		if rate > 0 {
+			return rate, nil
+		}
+
+		if base == model.QuoteAsset || quote == model.QuoteAsset {
+			continue
+		}
+
+		// most assets only trade against QuoteAsset, so other pairs are
+		// valued through it
+		toQuote, err := c.rate(base, model.QuoteAsset, exchange, at)
+		if err != nil {
+			return 0, err
+		}
+
+		if toQuote == 0 {
+			continue
+		}
+
+		fromQuote, err := c.rate(model.QuoteAsset, quote, exchange, at)
+		if err != nil {
+			return 0, err
+		}
+
+		if fromQuote > 0 {
+			return toQuote * fromQuote, nil
+		}
+	}
+
+	return 0, &NoPriceError{Asset: asset, Currency: currency}
+}
+
+// rate returns the price of base in quote from a market of one against
+// the other, or 0 if there is none.
+func (c *converter) rate(base, quote, exchange string, at time.Time) (float64, error) {
+	for _, symbol := range symbols(base, quote) {
+		price, err := c.price(exchange, symbol, at)
+		if err != nil {
+			return 0, err
+		}
+
+		if price > 0 {
+			return price, nil
+		}
+	}
+
+	for _, symbol := range symbols(quote, base) {
+		price, err := c.price(exchange, symbol, at)
+		if err != nil {
+			return 0, err
+		}
+
+		if price > 0 {
+			return 1 / price, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// price returns the price of the symbol at the given time, or its latest
+// price if the time is zero or too recent to be sampled yet, or 0 if there
+// is none. Older times the price history does not reach back to have no
+// price, rather than one that is off by however much it moved since.
+func (c *converter) price(exchange, symbol string, at time.Time) (float64, error) {
+	if !at.IsZero() {
+		sample, err := c.repo.GetPriceAt(exchange, symbol, at.UnixMilli())
+		if err != nil {
+			return 0, err
+		}
+
+		if sample != nil {
+			return sample.Price, nil
+		}
+
+		if time.Since(at) > latestPriceAge {
+			return 0, nil
+		}
+	}
+
+	price, err := c.repo.GetSymbolPrice(exchange, symbol)
+	if err != nil {
+		return 0, err
+	}
+
+	if price == nil {
+		return 0, nil
+	}
+
+	return price.Price, nil
+}
+
+// symbols returns the symbols the base asset may be listed under against
+// the quote asset, across supported exchanges.
+func symbols(base, quote string) []string {
+	symbols := []string{
+		base + quote,
+		base + "-" + quote + "-SWAP",
+	}
+
+	// coin-m perpetuals are priced in USD
+	if quote == model.QuoteAsset {
+		symbols = append(symbols, base+usd+"_PERP")
+	}
+
+	return symbols
+}
+
+func canonical(asset string) string {
+	asset = strings.ToUpper(asset)
+	if asset == usd {
+		return model.QuoteAsset
+	}
+
+	return asset
+}